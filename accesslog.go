@@ -0,0 +1,68 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// accessLogHandler logs requests served by next, one line each. Responses
+// with an error status are always logged, successful ones 1 in rate, so the
+// access log stays affordable under load.
+type accessLogHandler struct {
+	next      http.Handler
+	rate      uint64
+	successes uint64
+	logf      func(format string, v ...interface{})
+}
+
+func newAccessLogHandler(next http.Handler, rate int) *accessLogHandler {
+	return &accessLogHandler{
+		next: next,
+		rate: uint64(rate),
+		logf: log.Printf,
+	}
+}
+
+func (h *accessLogHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	sw := &statusResponseWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+	h.next.ServeHTTP(sw, req)
+
+	if sw.status < 400 && atomic.AddUint64(&h.successes, 1)%h.rate != 0 {
+		return
+	}
+	h.logf("%s %s %s %d %dB %v", req.RemoteAddr, req.Method, req.URL.RequestURI(),
+		sw.status, sw.written, time.Since(start))
+}
+
+// statusResponseWriter records the status and size of a response
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += n
+	return n, err
+}
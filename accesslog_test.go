@@ -0,0 +1,65 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogSampling(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			http.Error(w, "not found", 404)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	var lines []string
+	handler := newAccessLogHandler(next, 10)
+	handler.logf = func(format string, v ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, v...))
+	}
+
+	serve := func(path string) {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	for i := 0; i < 1000; i++ {
+		serve("/ok")
+		if i%100 == 0 {
+			serve("/missing")
+		}
+	}
+
+	var successes, errors int
+	for _, line := range lines {
+		switch {
+		case strings.Contains(line, "GET /ok 200 2B"):
+			successes++
+		case strings.Contains(line, "GET /missing 404"):
+			errors++
+		default:
+			t.Errorf("unexpected log line %q", line)
+		}
+	}
+	if successes < 90 || successes > 110 {
+		t.Errorf("expected about 100 of 1000 successes logged, got %d", successes)
+	}
+	if errors != 10 {
+		t.Errorf("expected all 10 errors logged, got %d", errors)
+	}
+}
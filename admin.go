@@ -0,0 +1,235 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/index/scorch"
+)
+
+// vacuumHandler serves POST /api/admin/vacuum, merging the segments of a
+// scorch index into one so the space held by deleted documents is
+// reclaimed, and reporting the disk usage of the index before and after.
+// Disk usage counts only the files of the current snapshot, older files
+// are removed by scorch in the background. An index already down to a
+// single segment is left as is. Only one vacuum runs at a time.
+type vacuumHandler struct {
+	defaultIndexName string
+	running          int32
+}
+
+func newVacuumHandler(defaultIndexName string) *vacuumHandler {
+	return &vacuumHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *vacuumHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&h.running, 0, 1) {
+		showError(w, req, "vacuum already in progress", 409)
+		return
+	}
+	defer atomic.StoreInt32(&h.running, 0)
+
+	advanced, _, err := index.Advanced()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error accessing index: %v", err), 500)
+		return
+	}
+	scorchIndex, ok := advanced.(*scorch.Scorch)
+	if !ok {
+		showError(w, req, "vacuum is only supported by scorch indexes", 501)
+		return
+	}
+
+	before := rootDiskUsage(scorchIndex)
+	// nil options request a merge down to a single segment, which drops
+	// every deleted document
+	err = scorchIndex.ForceMerge(context.Background(), nil)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error merging index: %v", err), 500)
+		return
+	}
+	after := rootDiskUsage(scorchIndex)
+	docCount, err := index.DocCount()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error counting documents: %v", err), 500)
+		return
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"bytes_before":    before,
+		"bytes_after":     after,
+		"bytes_reclaimed": before - after,
+		"doc_count":       docCount,
+	})
+}
+
+// rootDiskUsage returns the bytes on disk used by the current snapshot of i
+func rootDiskUsage(i *scorch.Scorch) int64 {
+	used, _ := i.StatsMap()["num_bytes_used_disk_by_root"].(uint64)
+	return int64(used)
+}
+
+// draining is set once POST /api/admin/drain has been called
+var draining int32
+
+// readyzHandler serves GET /readyz for load balancer health checks,
+// reporting 503 once the process is draining, or while the index is still
+// opening. disk_full reports indexing held up by a full disk, which leaves
+// searches unaffected, so it does not fail the check.
+type readyzHandler struct{}
+
+func newReadyzHandler() *readyzHandler {
+	return &readyzHandler{}
+}
+
+func (h *readyzHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if atomic.LoadInt32(&draining) != 0 || atomic.LoadInt32(&indexUnavailable) != 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		mustEncode(w, map[string]interface{}{
+			"ready":     false,
+			"disk_full": atomic.LoadInt32(&diskFull) != 0,
+		})
+		return
+	}
+	mustEncode(w, map[string]interface{}{
+		"ready":     true,
+		"disk_full": atomic.LoadInt32(&diskFull) != 0,
+	})
+}
+
+// drainHandler serves POST /api/admin/drain, failing readiness checks so a
+// load balancer stops routing new traffic here. Every other endpoint keeps
+// serving, so requests already routed here complete, and the process can be
+// terminated once the balancer has caught up. Draining cannot be undone
+// without a restart.
+type drainHandler struct{}
+
+func newDrainHandler() *drainHandler {
+	return &drainHandler{}
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.StoreInt32(&draining, 1)
+	log.Printf("draining, readiness checks will now fail")
+	mustEncode(w, map[string]interface{}{
+		"draining": true,
+	})
+}
+
+// indexingGate lets background indexing be paused between batches
+type indexingGate struct {
+	m       sync.Mutex
+	paused  bool
+	resumed chan struct{}
+}
+
+// indexingGatePollInterval is how often a paused wait calls its stop func
+var indexingGatePollInterval = 100 * time.Millisecond
+
+func newIndexingGate() *indexingGate {
+	return &indexingGate{}
+}
+
+func (g *indexingGate) setPaused(paused bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	if paused && !g.paused {
+		g.resumed = make(chan struct{})
+	} else if !paused && g.paused {
+		close(g.resumed)
+	}
+	g.paused = paused
+}
+
+func (g *indexingGate) isPaused() bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.paused
+}
+
+// wait blocks while indexing is paused, calling stop, if set, every
+// indexingGatePollInterval. It returns false when stop reported true before
+// indexing was resumed.
+func (g *indexingGate) wait(stop func() bool) bool {
+	for {
+		g.m.Lock()
+		paused, resumed := g.paused, g.resumed
+		g.m.Unlock()
+		if !paused {
+			return true
+		}
+		if stop != nil && stop() {
+			return false
+		}
+		select {
+		case <-resumed:
+		case <-time.After(indexingGatePollInterval):
+		}
+	}
+}
+
+// indexingPause is checked by indexBeer before each batch, its state is
+// published as the indexing_paused expvar
+var indexingPause = newIndexingGate()
+
+func init() {
+	expvar.Publish("indexing_paused", expvar.Func(func() interface{} {
+		return indexingPause.isPaused()
+	}))
+}
+
+// indexingPauseHandler serves POST /api/admin/indexing/pause and
+// /api/admin/indexing/resume, pausing background indexing so it stops
+// competing with searches, and resuming it. The batch in progress when
+// indexing is paused completes first. Documents indexed through the API are
+// not affected.
+type indexingPauseHandler struct {
+	gate  *indexingGate
+	pause bool
+}
+
+func newIndexingPauseHandler(gate *indexingGate, pause bool) *indexingPauseHandler {
+	return &indexingPauseHandler{
+		gate:  gate,
+		pause: pause,
+	}
+}
+
+func (h *indexingPauseHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.gate.setPaused(h.pause)
+	if h.pause {
+		log.Printf("background indexing paused")
+	} else {
+		log.Printf("background indexing resumed")
+	}
+	mustEncode(w, map[string]interface{}{
+		"paused": h.pause,
+	})
+}
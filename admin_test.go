@@ -0,0 +1,236 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/index/scorch"
+)
+
+func TestVacuum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beer-search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vacuum.bleve")
+
+	mapping, err := buildIndexMapping(scorch.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep the background merger from combining the batches itself
+	config := map[string]interface{}{
+		"scorchMergePlanOptions": map[string]interface{}{
+			"MaxSegmentsPerTier": 100,
+			"FloorSegmentSize":   1,
+		},
+	}
+	index, err := bleve.NewUsing(path, mapping, scorch.Name, bleve.Config.DefaultKVStore, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	bleveHttp.RegisterIndexName("vacuumTest", index)
+	defer bleveHttp.UnregisterIndexByName("vacuumTest")
+
+	// index in several batches so there are segments to merge
+	description := strings.Repeat("a rich malty brew with notes of caramel ", 20)
+	for b := 0; b < 4; b++ {
+		batch := index.NewBatch()
+		for i := 0; i < 50; i++ {
+			err = batch.Index(fmt.Sprintf("beer-%d-%d", b, i), map[string]interface{}{
+				"type":        "beer",
+				"name":        fmt.Sprintf("Beer %d %d", b, i),
+				"description": description,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = index.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := index.NewBatch()
+	for b := 0; b < 4; b++ {
+		for i := 0; i < 50; i += 2 {
+			batch.Delete(fmt.Sprintf("beer-%d-%d", b, i))
+		}
+	}
+	err = index.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "/api/admin/vacuum", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newVacuumHandler("vacuumTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result struct {
+		Before    int64  `json:"bytes_before"`
+		After     int64  `json:"bytes_after"`
+		Reclaimed int64  `json:"bytes_reclaimed"`
+		DocCount  uint64 `json:"doc_count"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.After >= result.Before || result.Reclaimed != result.Before-result.After {
+		t.Errorf("expected disk usage to drop, got %+v", result)
+	}
+	if result.DocCount != 100 {
+		t.Errorf("expected 100 live documents, got %d", result.DocCount)
+	}
+
+	// a second vacuum is refused while one is running
+	busy := newVacuumHandler("vacuumTest")
+	busy.running = 1
+	rr = httptest.NewRecorder()
+	busy.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for concurrent vacuum, got %d", rr.Code)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("drainTest", index)
+	defer bleveHttp.UnregisterIndexByName("drainTest")
+	defer atomic.StoreInt32(&draining, 0)
+
+	readyz := func() int {
+		req, err := http.NewRequest("GET", "/readyz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newReadyzHandler().ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := readyz(); code != http.StatusOK {
+		t.Fatalf("expected readyz 200 before draining, got %d", code)
+	}
+
+	req, err := http.NewRequest("POST", "/api/admin/drain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newDrainHandler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected readyz 503 after draining, got %d", code)
+	}
+	code, result := serveTestSearch(t, "drainTest", "q=stout")
+	if code != http.StatusOK {
+		t.Fatalf("expected searches to keep working while draining, got %d", code)
+	}
+	if result["total_hits"].(float64) != 1 {
+		t.Errorf("expected 1 hit while draining, got %v", result["total_hits"])
+	}
+}
+
+func TestIndexingPause(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	defer func(orig int) { *batchSize = orig }(*batchSize)
+	defer indexingPause.setPaused(false)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"a.json": `{"type":"beer","name":"Alpha"}`,
+		"b.json": `{"type":"beer","name":"Beta"}`,
+		"c.json": `{"type":"beer","name":"Gamma"}`,
+		"d.json": `{"type":"beer","name":"Delta"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+	*batchSize = 2
+
+	serve := func(path string, pause bool) {
+		req, err := http.NewRequest("POST", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newIndexingPauseHandler(indexingPause, pause).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 from %s, got %d", path, rr.Code)
+		}
+	}
+	docCount := func(index bleve.Index) uint64 {
+		count, err := index.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+
+	serve("/api/admin/indexing/pause", true)
+	if paused := expvar.Get("indexing_paused").String(); paused != "true" {
+		t.Errorf("expected indexing_paused true, got %s", paused)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- indexBeer(index)
+	}()
+
+	// paused indexing makes no progress
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("expected indexing to wait while paused, it finished with %v", err)
+	default:
+	}
+	if count := docCount(index); count != 0 {
+		t.Errorf("expected no documents indexed while paused, got %d", count)
+	}
+
+	serve("/api/admin/indexing/resume", false)
+	if paused := expvar.Get("indexing_paused").String(); paused != "false" {
+		t.Errorf("expected indexing_paused false, got %s", paused)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected indexing to finish once resumed")
+	}
+	if count := docCount(index); count != 4 {
+		t.Errorf("expected 4 documents indexed once resumed, got %d", count)
+	}
+}
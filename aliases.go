@@ -0,0 +1,130 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// fieldAliasMap maps the field names accepted in queries to the indexed
+// fields they stand for, as configured by -fieldAliases
+var fieldAliasMap map[string]string
+
+// parseFieldAliases parses a comma separated list of alias=field pairs
+func parseFieldAliases(s string) (map[string]string, error) {
+	return parseFieldPairs(s, "field alias", "alias=field")
+}
+
+// parseFieldPairs parses a comma separated list of name=name pairs, kind
+// and form describe the pairs in errors
+func parseFieldPairs(s, kind, form string) (map[string]string, error) {
+	rv := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid %s '%s', expected %s", kind, pair, form)
+		}
+		rv[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return rv, nil
+}
+
+// aliasField returns the field that field is an alias for, or field itself
+func aliasField(field string) string {
+	if target, ok := fieldAliasMap[field]; ok {
+		return target
+	}
+	return field
+}
+
+// aliasQueryFields rewrites the fields targeted by q and its sub-queries.
+// Query strings are parsed so the fields they name can be rewritten too.
+func aliasQueryFields(q query.Query) (query.Query, error) {
+	if len(fieldAliasMap) == 0 {
+		return q, nil
+	}
+	switch q := q.(type) {
+	case *query.QueryStringQuery:
+		parsed, err := q.Parse()
+		if err != nil {
+			return nil, err
+		}
+		return aliasQueryFields(parsed)
+	case *query.ConjunctionQuery:
+		for i, conjunct := range q.Conjuncts {
+			rewritten, err := aliasQueryFields(conjunct)
+			if err != nil {
+				return nil, err
+			}
+			q.Conjuncts[i] = rewritten
+		}
+	case *query.DisjunctionQuery:
+		for i, disjunct := range q.Disjuncts {
+			rewritten, err := aliasQueryFields(disjunct)
+			if err != nil {
+				return nil, err
+			}
+			q.Disjuncts[i] = rewritten
+		}
+	case *query.BooleanQuery:
+		for _, clause := range []*query.Query{&q.Must, &q.Should, &q.MustNot} {
+			if *clause == nil {
+				continue
+			}
+			rewritten, err := aliasQueryFields(*clause)
+			if err != nil {
+				return nil, err
+			}
+			*clause = rewritten
+		}
+	case query.FieldableQuery:
+		q.SetField(aliasField(q.Field()))
+	}
+	return q, nil
+}
+
+// aliasSearchRequest rewrites the fields named anywhere in searchRequest:
+// the query, facets, sort order, requested fields and highlighted fields
+func aliasSearchRequest(searchRequest *bleve.SearchRequest) error {
+	if len(fieldAliasMap) == 0 {
+		return nil
+	}
+	q, err := aliasQueryFields(searchRequest.Query)
+	if err != nil {
+		return err
+	}
+	searchRequest.Query = q
+	for _, facet := range searchRequest.Facets {
+		facet.Field = aliasField(facet.Field)
+	}
+	for _, sort := range searchRequest.Sort {
+		if sortField, ok := sort.(*search.SortField); ok {
+			sortField.Field = aliasField(sortField.Field)
+		}
+	}
+	for i, field := range searchRequest.Fields {
+		searchRequest.Fields[i] = aliasField(field)
+	}
+	if searchRequest.Highlight != nil {
+		for i, field := range searchRequest.Highlight.Fields {
+			searchRequest.Highlight.Fields[i] = aliasField(field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestFieldAliases(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"ipa": map[string]interface{}{
+			"type":     "beer",
+			"name":     "Hop Bomb",
+			"style":    "American-Style India Pale Ale",
+			"category": "IPA",
+		},
+		"stout": map[string]interface{}{
+			"type":     "beer",
+			"name":     "Dark Night",
+			"style":    "Oatmeal Stout",
+			"category": "Stout",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("aliasTest", index)
+	defer bleveHttp.UnregisterIndexByName("aliasTest")
+
+	search := func(body string) map[string]interface{} {
+		req, err := http.NewRequest("POST", "/api/search", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newSearchRequestHandler("aliasTest").ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var rv map[string]interface{}
+		err = json.Unmarshal(rr.Body.Bytes(), &rv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+	body := `{"query": {"query": "style:IPA"}, "facets": {"styles": {"field": "style", "size": 5}}}`
+
+	// without aliases style is matched against the style field
+	defer func(orig map[string]string) { fieldAliasMap = orig }(fieldAliasMap)
+	fieldAliasMap = nil
+	result := search(body)
+	if result["total_hits"].(float64) != 0 {
+		t.Errorf("expected no hits without aliases, got %v", result["total_hits"])
+	}
+
+	var err error
+	fieldAliasMap, err = parseFieldAliases("style=category")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = search(body)
+	hits := result["hits"].([]interface{})
+	if len(hits) != 1 || hits[0].(map[string]interface{})["id"] != "ipa" {
+		t.Errorf("expected the alias to hit ipa, got %v", hits)
+	}
+	facet := result["facets"].(map[string]interface{})["styles"].(map[string]interface{})
+	if facet["field"] != "category" {
+		t.Errorf("expected facet over category, got %v", facet["field"])
+	}
+	terms := facet["terms"].([]interface{})
+	if len(terms) != 1 || terms[0].(map[string]interface{})["term"] != "IPA" {
+		t.Errorf("expected facet term IPA, got %v", terms)
+	}
+
+	// the GET wrapper applies aliases to its field parameter
+	_, getResult := serveTestSearch(t, "aliasTest", "q=Stout&field=style")
+	getHits := getResult["hits"].([]interface{})
+	if len(getHits) != 1 || getHits[0].(map[string]interface{})["id"] != "stout" {
+		t.Errorf("expected the GET wrapper alias to hit stout, got %v", getHits)
+	}
+
+	for _, invalid := range []string{"style", "=category", "style="} {
+		_, err = parseFieldAliases(invalid)
+		if err == nil {
+			t.Errorf("expected error parsing '%s'", invalid)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// analyses caches the analysis of query text by searches and of documents
+// by mapping previews against the live mapping, sized by -analysisCacheSize
+var analyses = newAnalysisCache(0)
+
+type analysisKey struct {
+	analyzer string
+	text     string
+}
+
+type analysisEntry struct {
+	key    analysisKey
+	tokens analysis.TokenStream
+}
+
+// analysisCache is a least recently used cache of the token streams named
+// analyzers produce, so hot text is only analyzed once. Analyzers are looked
+// up in the mapping passed to analyze, and analyzing against a different
+// mapping, such as after the index is reopened with a new one, drops every
+// cached stream first. A cache of size 0 analyzes every time.
+type analysisCache struct {
+	size int
+
+	mu      sync.Mutex
+	mapping mapping.IndexMapping
+	entries map[analysisKey]*list.Element
+	order   *list.List
+}
+
+func newAnalysisCache(size int) *analysisCache {
+	return &analysisCache{
+		size:    size,
+		entries: make(map[analysisKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// analyze returns the tokens the analyzer named analyzerName in m produces
+// for text. The tokens are the caller's own to modify.
+func (c *analysisCache) analyze(m mapping.IndexMapping, analyzerName, text string) (analysis.TokenStream, error) {
+	key := analysisKey{analyzer: analyzerName, text: text}
+	if c.size > 0 {
+		c.mu.Lock()
+		if c.mapping != m {
+			c.entries = make(map[analysisKey]*list.Element)
+			c.order.Init()
+			c.mapping = m
+		}
+		if element, ok := c.entries[key]; ok {
+			c.order.MoveToFront(element)
+			tokens := copyTokenStream(element.Value.(*analysisEntry).tokens)
+			c.mu.Unlock()
+			return tokens, nil
+		}
+		c.mu.Unlock()
+	}
+
+	analyzer := m.AnalyzerNamed(analyzerName)
+	if analyzer == nil {
+		return nil, fmt.Errorf("no analyzer named '%s'", analyzerName)
+	}
+	tokens := analyzer.Analyze([]byte(text))
+	if c.size <= 0 {
+		return tokens, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mapping != m {
+		// the mapping changed while analyzing, leave the new one's cache be
+		return tokens, nil
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&analysisEntry{
+			key:    key,
+			tokens: copyTokenStream(tokens),
+		})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*analysisEntry).key)
+		}
+	}
+	return tokens, nil
+}
+
+// copyTokenStream deep copies tokens, so cached streams are never shared
+// with callers
+func copyTokenStream(tokens analysis.TokenStream) analysis.TokenStream {
+	rv := make(analysis.TokenStream, len(tokens))
+	for i, token := range tokens {
+		tokenCopy := *token
+		tokenCopy.Term = append([]byte(nil), token.Term...)
+		rv[i] = &tokenCopy
+	}
+	return rv
+}
+
+// withCachedAnalysis returns q set up to analyze its text through cache, or
+// q itself when cache is disabled. Wrap queries only once they have been
+// validated and inspected, as the wrapper hides the type of q.
+func withCachedAnalysis(q query.Query, cache *analysisCache) query.Query {
+	if cache.size <= 0 {
+		return q
+	}
+	return &cachedAnalysisQuery{
+		Query: q,
+		cache: cache,
+	}
+}
+
+// cachedAnalysisQuery searches with a mapping whose analyzers go through
+// cache, so match, phrase and query string queries for hot text skip
+// analysis
+type cachedAnalysisQuery struct {
+	query.Query
+	cache *analysisCache
+}
+
+func (q *cachedAnalysisQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	return q.Query.Searcher(i, &cachedAnalysisMapping{IndexMapping: m, cache: q.cache}, options)
+}
+
+// MarshalJSON marshals the wrapped query, so search results echo the
+// request as it was made
+func (q *cachedAnalysisQuery) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.Query)
+}
+
+type cachedAnalysisMapping struct {
+	mapping.IndexMapping
+	cache *analysisCache
+}
+
+// AnalyzerNamed returns an analyzer producing the cached analysis of the
+// analyzer named name
+func (m *cachedAnalysisMapping) AnalyzerNamed(name string) *analysis.Analyzer {
+	if m.IndexMapping.AnalyzerNamed(name) == nil {
+		return nil
+	}
+	return &analysis.Analyzer{
+		Tokenizer: &cachedTokenizer{
+			mapping:  m.IndexMapping,
+			analyzer: name,
+			cache:    m.cache,
+		},
+	}
+}
+
+// cachedTokenizer stands in for a whole analyzer, returning its cached
+// token stream
+type cachedTokenizer struct {
+	mapping  mapping.IndexMapping
+	analyzer string
+	cache    *analysisCache
+}
+
+func (t *cachedTokenizer) Tokenize(input []byte) analysis.TokenStream {
+	// the analyzer is known to exist, so this cannot fail
+	tokens, _ := t.cache.analyze(t.mapping, t.analyzer, string(input))
+	return tokens
+}
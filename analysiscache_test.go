@@ -0,0 +1,181 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+const analysisCacheTestText = "The brewers were brewing creamy Irish stouts and hoppy pale ales"
+
+func TestAnalysisCache(t *testing.T) {
+	m, err := buildIndexMapping(bleve.Config.DefaultIndexType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := m.AnalyzerNamed(en.AnalyzerName).Analyze([]byte(analysisCacheTestText))
+
+	cache := newAnalysisCache(2)
+	for i := 0; i < 2; i++ {
+		tokens, err := cache.analyze(m, en.AnalyzerName, analysisCacheTestText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tokens, fresh) {
+			t.Errorf("expected %v, got %v", fresh, tokens)
+		}
+		// callers own the tokens they are given
+		tokens[0].Term[0] = 'X'
+	}
+	if cache.order.Len() != 1 {
+		t.Errorf("expected 1 cached stream, got %d", cache.order.Len())
+	}
+
+	// the least recently used stream is evicted
+	_, err = cache.analyze(m, en.AnalyzerName, "ale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cache.analyze(m, exactCaseAnalyzer, "Ale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.entries[analysisKey{en.AnalyzerName, analysisCacheTestText}]; ok {
+		t.Error("expected the oldest stream to be evicted")
+	}
+	if cache.order.Len() != 2 {
+		t.Errorf("expected 2 cached streams, got %d", cache.order.Len())
+	}
+
+	// a new mapping starts from an empty cache
+	other, err := buildIndexMapping(bleve.Config.DefaultIndexType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cache.analyze(other, en.AnalyzerName, "ale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.order.Len() != 1 {
+		t.Errorf("expected 1 cached stream after a mapping change, got %d", cache.order.Len())
+	}
+
+	if _, err := cache.analyze(m, "no_such_analyzer", "ale"); err == nil {
+		t.Error("expected an error for an unknown analyzer")
+	}
+}
+
+func TestCachedAnalysisSearch(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+
+	cache := newAnalysisCache(16)
+	for _, q := range []query.Query{
+		bleve.NewMatchQuery("creamy irish stouts"),
+		bleve.NewMatchPhraseQuery("irish stout"),
+		bleve.NewQueryStringQuery("description:irish -red"),
+	} {
+		expected, err := index.Search(bleve.NewSearchRequest(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			searchResult, err := index.Search(bleve.NewSearchRequest(withCachedAnalysis(q, cache)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(searchResultIDs(searchResult), searchResultIDs(expected)) {
+				t.Errorf("%T: expected %v, got %v", q, searchResultIDs(expected), searchResultIDs(searchResult))
+			}
+		}
+
+		// the request is echoed as it was made
+		queryJSON, err := json.Marshal(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cachedJSON, err := json.Marshal(withCachedAnalysis(q, cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(cachedJSON) != string(queryJSON) {
+			t.Errorf("expected %s, got %s", queryJSON, cachedJSON)
+		}
+	}
+	// the query string analyzes each of its terms
+	if cache.order.Len() != 4 {
+		t.Errorf("expected the analysis of 4 texts cached, got %d", cache.order.Len())
+	}
+
+	if q := bleve.NewMatchQuery("stout"); withCachedAnalysis(q, newAnalysisCache(0)) != query.Query(q) {
+		t.Error("expected a disabled cache to leave queries unwrapped")
+	}
+}
+
+func searchResultIDs(searchResult *bleve.SearchResult) []string {
+	ids := make([]string, len(searchResult.Hits))
+	for i, hit := range searchResult.Hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+func benchmarkAnalysisCache(b *testing.B, size int) {
+	m, err := buildIndexMapping(bleve.Config.DefaultIndexType)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cache := newAnalysisCache(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := cache.analyze(m, en.AnalyzerName, analysisCacheTestText)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAnalysisUncached(b *testing.B) {
+	benchmarkAnalysisCache(b, 0)
+}
+
+func BenchmarkAnalysisCached(b *testing.B) {
+	benchmarkAnalysisCache(b, 1024)
+}
+
+// benchmarkAnalysisCacheSearch runs a match query as the search handlers
+// do, analyzing its text through a cache of size
+func benchmarkAnalysisCacheSearch(b *testing.B, size int) {
+	index := newTestIndex(b, searchTestDocs)
+	defer index.Close()
+	cache := newAnalysisCache(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := withCachedAnalysis(buildMatchQuery(analysisCacheTestText, "description"), cache)
+		_, err := index.Search(bleve.NewSearchRequest(q))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAnalysisUncachedSearch(b *testing.B) {
+	benchmarkAnalysisCacheSearch(b, 0)
+}
+
+func BenchmarkAnalysisCachedSearch(b *testing.B) {
+	benchmarkAnalysisCacheSearch(b, 1024)
+}
@@ -0,0 +1,228 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// breweryIDField links a beer to the id of its brewery document
+const breweryIDField = "brewery_id"
+
+// brewerySummary aggregates the beers of one brewery. The ABV figures only
+// cover beers with an abv, and are omitted when none has one.
+type brewerySummary struct {
+	ID        string   `json:"id"`
+	BeerCount uint64   `json:"beer_count"`
+	AvgABV    *float64 `json:"avg_abv,omitempty"`
+	MinABV    *float64 `json:"min_abv,omitempty"`
+	MaxABV    *float64 `json:"max_abv,omitempty"`
+	Styles    []string `json:"styles"`
+}
+
+// brewerySummaryHandler serves GET /api/brewery/{docID}/summary, summarizing
+// the beers whose brewery_id is docID. A brewery with neither a document
+// nor any beers is a 404.
+type brewerySummaryHandler struct {
+	defaultIndexName string
+	DocIDLookup      func(req *http.Request) string
+}
+
+func newBrewerySummaryHandler(defaultIndexName string) *brewerySummaryHandler {
+	return &brewerySummaryHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *brewerySummaryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	// find the brewery id
+	var breweryID string
+	if h.DocIDLookup != nil {
+		breweryID = h.DocIDLookup(req)
+	}
+	if breweryID == "" {
+		showError(w, req, "brewery id cannot be empty", 400)
+		return
+	}
+
+	beersQuery := bleve.NewTermQuery(breweryID)
+	beersQuery.SetField(breweryIDField)
+
+	// count the beers first, so the second search can return all of them
+	countRequest := bleve.NewSearchRequestOptions(beersQuery, 0, 0, false)
+	countResult, err := index.Search(countRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+	if countResult.Total == 0 {
+		doc, err := index.Document(breweryID)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error looking up brewery '%s': %v", breweryID, err), 500)
+			return
+		}
+		if doc == nil {
+			showError(w, req, fmt.Sprintf("no such brewery '%s'", breweryID), 404)
+			return
+		}
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(beersQuery, int(countResult.Total), 0, false)
+	searchRequest.Fields = []string{"abv"}
+	stylesFacet := bleve.NewFacetRequest("style", int(countResult.Total)+1)
+	searchRequest.AddFacet("styles", stylesFacet)
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+
+	summary := brewerySummary{
+		ID:        breweryID,
+		BeerCount: searchResult.Total,
+		Styles:    []string{},
+	}
+	var abvCount int
+	var abvSum, abvMin, abvMax float64
+	for _, hit := range searchResult.Hits {
+		abv, ok := hit.Fields["abv"].(float64)
+		if !ok {
+			continue
+		}
+		if abvCount == 0 || abv < abvMin {
+			abvMin = abv
+		}
+		if abvCount == 0 || abv > abvMax {
+			abvMax = abv
+		}
+		abvSum += abv
+		abvCount++
+	}
+	if abvCount > 0 {
+		abvAvg := abvSum / float64(abvCount)
+		summary.AvgABV, summary.MinABV, summary.MaxABV = &abvAvg, &abvMin, &abvMax
+	}
+	if styles := searchResult.Facets["styles"]; styles != nil && styles.Terms != nil {
+		for _, term := range styles.Terms {
+			summary.Styles = append(summary.Styles, term.Term)
+		}
+	}
+	sort.Strings(summary.Styles)
+
+	mustEncode(w, summary)
+}
+
+// breweryCount is a brewery listed with the number of beers linked to it.
+// The name is omitted for breweries without a document.
+type breweryCount struct {
+	ID        string `json:"id"`
+	Name      string `json:"name,omitempty"`
+	BeerCount int    `json:"beer_count"`
+}
+
+// breweriesHandler serves GET /api/breweries?from=&size=, listing the
+// breweries beers link to by brewery_id, most beers first and ties by id,
+// for browsing the catalog by brewery. Each id can be passed on to
+// /api/brewery/{docID}/summary, or filter a search with a term query on
+// brewery_id. has_more reports whether breweries follow this page.
+type breweriesHandler struct {
+	defaultIndexName string
+}
+
+func newBreweriesHandler(defaultIndexName string) *breweriesHandler {
+	return &breweriesHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *breweriesHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	from, err := intParam(req, "from", 0)
+	if err != nil || from < 0 {
+		showError(w, req, fmt.Sprintf("invalid from '%s'", req.FormValue("from")), 400)
+		return
+	}
+	size, err := intParam(req, "size", 10)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+
+	// facets only return their top terms, so ask for everything up to the
+	// end of the page
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	searchRequest.AddFacet("breweries", bleve.NewFacetRequest(breweryIDField, from+size))
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+
+	breweries := []breweryCount{}
+	hasMore := false
+	if facet := searchResult.Facets["breweries"]; facet != nil {
+		if from < len(facet.Terms) {
+			for _, term := range facet.Terms[from:] {
+				breweries = append(breweries, breweryCount{
+					ID:        term.Term,
+					BeerCount: term.Count,
+				})
+			}
+		}
+		hasMore = facet.Other > 0
+	}
+
+	// look up the names of the breweries on the page
+	if len(breweries) > 0 {
+		ids := make([]string, len(breweries))
+		for i, brewery := range breweries {
+			ids[i] = brewery.ID
+		}
+		namesRequest := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(ids), len(ids), 0, false)
+		namesRequest.Fields = []string{"name"}
+		namesResult, err := index.Search(namesRequest)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error looking up brewery names: %v", err), 500)
+			return
+		}
+		names := make(map[string]string, len(namesResult.Hits))
+		for _, hit := range namesResult.Hits {
+			if name, ok := hit.Fields["name"].(string); ok {
+				names[hit.ID] = name
+			}
+		}
+		for i := range breweries {
+			breweries[i].Name = names[breweries[i].ID]
+		}
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"breweries": breweries,
+		"has_more":  hasMore,
+	})
+}
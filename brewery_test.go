@@ -0,0 +1,225 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestBrewerySummary(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"dogfish_head": map[string]interface{}{
+			"type": "brewery",
+			"name": "Dogfish Head Craft Brewery",
+		},
+		"empty_brewery": map[string]interface{}{
+			"type": "brewery",
+			"name": "Empty Brewery",
+		},
+		"dogfish-60": map[string]interface{}{
+			"type":       "beer",
+			"name":       "60 Minute IPA",
+			"brewery_id": "dogfish_head",
+			"abv":        6.0,
+			"style":      "American-Style India Pale Ale",
+		},
+		"dogfish-90": map[string]interface{}{
+			"type":       "beer",
+			"name":       "90 Minute IPA",
+			"brewery_id": "dogfish_head",
+			"abv":        9.0,
+			"style":      "Imperial or Double India Pale Ale",
+		},
+		"dogfish-120": map[string]interface{}{
+			"type":       "beer",
+			"name":       "120 Minute IPA",
+			"brewery_id": "dogfish_head",
+			"abv":        18.0,
+			"style":      "Imperial or Double India Pale Ale",
+		},
+		"dogfish-tea": map[string]interface{}{
+			"type":       "beer",
+			"name":       "Dogfish Tea Beer",
+			"brewery_id": "dogfish_head",
+			"style":      "Herb and Spice Beer",
+		},
+		"other-ale": map[string]interface{}{
+			"type":       "beer",
+			"name":       "Other Ale",
+			"brewery_id": "other_brewery",
+			"abv":        4.0,
+			"style":      "Ordinary Bitter",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("brewerySummaryTest", index)
+	defer bleveHttp.UnregisterIndexByName("brewerySummaryTest")
+
+	serve := func(id string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/brewery/"+id+"/summary", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := newBrewerySummaryHandler("brewerySummaryTest")
+		handler.DocIDLookup = func(*http.Request) string { return id }
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("dogfish_head")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var summary brewerySummary
+	err := json.Unmarshal(rr.Body.Bytes(), &summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.BeerCount != 4 {
+		t.Errorf("expected 4 beers, got %d", summary.BeerCount)
+	}
+	// the tea beer has no abv, so it does not count towards the average
+	if summary.AvgABV == nil || *summary.AvgABV != 11 {
+		t.Errorf("expected average abv 11, got %v", summary.AvgABV)
+	}
+	if summary.MinABV == nil || *summary.MinABV != 6 || summary.MaxABV == nil || *summary.MaxABV != 18 {
+		t.Errorf("expected abv from 6 to 18, got %v to %v", summary.MinABV, summary.MaxABV)
+	}
+	expectStyles := []string{
+		"American-Style India Pale Ale",
+		"Herb and Spice Beer",
+		"Imperial or Double India Pale Ale",
+	}
+	if !reflect.DeepEqual(summary.Styles, expectStyles) {
+		t.Errorf("expected styles %v, got %v", expectStyles, summary.Styles)
+	}
+
+	// a brewery without beers has an empty summary
+	rr = serve("empty_brewery")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for a brewery without beers, got %d", rr.Code)
+	}
+	var empty map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty["beer_count"] != 0.0 || empty["avg_abv"] != nil {
+		t.Errorf("expected an empty summary, got %v", empty)
+	}
+
+	if rr := serve("no_such_brewery"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown brewery, got %d", rr.Code)
+	}
+}
+
+func TestBreweries(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"dogfish_head": map[string]interface{}{
+			"type": "brewery",
+			"name": "Dogfish Head Craft Brewery",
+		},
+		"anchor": map[string]interface{}{
+			"type": "brewery",
+			"name": "Anchor Brewing",
+		},
+		"dogfish-60": map[string]interface{}{
+			"type":       "beer",
+			"name":       "60 Minute IPA",
+			"brewery_id": "dogfish_head",
+		},
+		"dogfish-90": map[string]interface{}{
+			"type":       "beer",
+			"name":       "90 Minute IPA",
+			"brewery_id": "dogfish_head",
+		},
+		"dogfish-120": map[string]interface{}{
+			"type":       "beer",
+			"name":       "120 Minute IPA",
+			"brewery_id": "dogfish_head",
+		},
+		"anchor-steam": map[string]interface{}{
+			"type":       "beer",
+			"name":       "Anchor Steam",
+			"brewery_id": "anchor",
+		},
+		"anchor-porter": map[string]interface{}{
+			"type":       "beer",
+			"name":       "Anchor Porter",
+			"brewery_id": "anchor",
+		},
+		"orphan-ale": map[string]interface{}{
+			"type":       "beer",
+			"name":       "Orphan Ale",
+			"brewery_id": "orphan_brewery",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("breweriesTest", index)
+	defer bleveHttp.UnregisterIndexByName("breweriesTest")
+
+	serve := func(rawQuery string) (int, []breweryCount, bool) {
+		req, err := http.NewRequest("GET", "/api/breweries?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newBreweriesHandler("breweriesTest").ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			return rr.Code, nil, false
+		}
+		var rv struct {
+			Breweries []breweryCount `json:"breweries"`
+			HasMore   bool           `json:"has_more"`
+		}
+		err = json.Unmarshal(rr.Body.Bytes(), &rv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr.Code, rv.Breweries, rv.HasMore
+	}
+
+	_, breweries, hasMore := serve("")
+	expect := []breweryCount{
+		{ID: "dogfish_head", Name: "Dogfish Head Craft Brewery", BeerCount: 3},
+		{ID: "anchor", Name: "Anchor Brewing", BeerCount: 2},
+		{ID: "orphan_brewery", BeerCount: 1},
+	}
+	if !reflect.DeepEqual(breweries, expect) {
+		t.Errorf("expected %v, got %v", expect, breweries)
+	}
+	if hasMore {
+		t.Error("expected no more breweries")
+	}
+
+	_, breweries, hasMore = serve("from=1&size=1")
+	if !reflect.DeepEqual(breweries, expect[1:2]) {
+		t.Errorf("expected %v, got %v", expect[1:2], breweries)
+	}
+	if !hasMore {
+		t.Error("expected more breweries after the second page")
+	}
+
+	_, breweries, _ = serve("from=5")
+	if len(breweries) != 0 {
+		t.Errorf("expected no breweries past the end, got %v", breweries)
+	}
+
+	if code, _, _ := serve("size=-1"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a negative size, got %d", code)
+	}
+}
@@ -0,0 +1,73 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// indexVersion counts the batches applied to the index since startup,
+// indexModified holds the time of the last one in unix nanoseconds
+var indexVersion uint64
+var indexModified = time.Now().UnixNano()
+
+// indexEpoch distinguishes versions counted by this process from those of an
+// earlier run, which may have indexed different documents
+var indexEpoch = indexModified
+
+// bumpIndexVersion records a mutation of the index, invalidating the ETags
+// of search responses served before it
+func bumpIndexVersion() {
+	atomic.StoreInt64(&indexModified, time.Now().UnixNano())
+	atomic.AddUint64(&indexVersion, 1)
+}
+
+// searchETag returns the ETag of a response to the search described by key
+// against the current version of the index. Read the ETag before running the
+// search, so a mutation racing it leaves the response with an older version
+// rather than vouching for results it did not see.
+func searchETag(key string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%d:%d:%s", indexEpoch, atomic.LoadUint64(&indexVersion), key)
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// notModified returns true, having responded, if the request's
+// If-None-Match lists etag. GET and HEAD requests are answered with a 304,
+// any other method with a 412 Precondition Failed, as RFC 7232 requires.
+func notModified(w http.ResponseWriter, req *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(req.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			setCacheValidators(w, etag)
+			if req.Method == "GET" || req.Method == "HEAD" {
+				w.WriteHeader(http.StatusNotModified)
+			} else {
+				w.WriteHeader(http.StatusPreconditionFailed)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheValidators sets the ETag and Last-Modified headers of a search
+// response, letting clients revalidate it with If-None-Match
+func setCacheValidators(w http.ResponseWriter, etag string) {
+	modified := time.Unix(0, atomic.LoadInt64(&indexModified))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+}
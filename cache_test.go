@@ -0,0 +1,142 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestSearchConditionalCaching(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("cacheTest", index)
+	defer bleveHttp.UnregisterIndexByName("cacheTest")
+
+	search := func(etag string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/search?q=irish", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		newSearchQueryHandler("cacheTest").ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := search("")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	if rr.Header().Get("Last-Modified") == "" {
+		t.Error("expected a Last-Modified header")
+	}
+
+	// revalidating an unchanged index is answered with a 304
+	for i := 0; i < 2; i++ {
+		rr = search(etag)
+		if rr.Code != http.StatusNotModified {
+			t.Fatalf("expected status 304, got %d", rr.Code)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("expected an empty body, got %s", rr.Body.String())
+		}
+	}
+
+	// a different query has its own ETag
+	req, err := http.NewRequest("GET", "/api/search?q=stout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	newSearchQueryHandler("cacheTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for another query, got %d", rr.Code)
+	}
+
+	// indexing a document bumps the version
+	handler := newDocIndexHandler("cacheTest")
+	handler.DocIDLookup = func(*http.Request) string { return "harp" }
+	req, err = http.NewRequest("PUT", "/api/doc/harp",
+		strings.NewReader(`{"type":"beer","name":"Harp","description":"An irish lager"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 indexing, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = search(etag)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 after a mutation, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "harp") {
+		t.Errorf("expected the new document in the results, got %s", rr.Body.String())
+	}
+	newETag := rr.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Errorf("expected a new ETag, got %q", newETag)
+	}
+	rr = search(newETag)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected status 304 for the new ETag, got %d", rr.Code)
+	}
+}
+
+func TestSearchRequestConditionalCaching(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("cacheTest", index)
+	defer bleveHttp.UnregisterIndexByName("cacheTest")
+
+	search := func(etag string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/api/search",
+			strings.NewReader(`{"query":{"match":"stout"}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		newSearchRequestHandler("cacheTest").ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := search("")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	etag := rr.Header().Get("ETag")
+	// only GET and HEAD can be answered with a 304
+	rr = search(etag)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status 412, got %d", rr.Code)
+	}
+
+	bumpIndexVersion()
+	rr = search(etag)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 after a mutation, got %d", rr.Code)
+	}
+}
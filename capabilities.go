@@ -0,0 +1,65 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// capabilitiesHandler serves GET /api/capabilities, describing the features
+// this server offers under its current flags, so front ends can adapt.
+// Features this server does not implement, such as geo search and
+// authentication, are reported as disabled.
+type capabilitiesHandler struct{}
+
+func newCapabilitiesHandler() *capabilitiesHandler {
+	return &capabilitiesHandler{}
+}
+
+func (h *capabilitiesHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	mustEncode(w, capabilities())
+}
+
+// capabilities reports the features enabled by the current flags
+func capabilities() map[string]interface{} {
+	highlighted := append([]string{}, highlightFieldList()...)
+	languages := make([]string, 0, len(descriptionLanguages))
+	for lang := range descriptionLanguages {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+
+	return map[string]interface{}{
+		"facets": true,
+		"highlighting": map[string]interface{}{
+			"enabled":    len(highlighted) > 0,
+			"fields":     highlighted,
+			"by_default": *highlightByDefault && len(highlighted) > 0,
+		},
+		"fuzzy": map[string]interface{}{
+			"enabled":   true,
+			"fuzziness": *defaultFuzziness,
+			"prefix":    *defaultFuzzyPrefix,
+		},
+		"languages": map[string]interface{}{
+			"supported": languages,
+			"default":   *defaultLanguage,
+		},
+		"synonyms":         *synonymsPath != "",
+		"field_aliases":    len(fieldAliasMap) > 0,
+		"source":           *storeSource,
+		"max_clauses":      *maxClauses,
+		"min_query_length": *minQueryLength,
+		"geo":              false,
+		"suggest":          true,
+		"auth":             false,
+	}
+}
@@ -0,0 +1,87 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	defer func(orig string) { *highlightFields = orig }(*highlightFields)
+	defer func(orig bool) { *highlightByDefault = orig }(*highlightByDefault)
+	defer func(orig bool) { *storeSource = orig }(*storeSource)
+	defer func(orig string) { *synonymsPath = orig }(*synonymsPath)
+	defer func(orig int) { *defaultFuzzyPrefix = orig }(*defaultFuzzyPrefix)
+
+	serve := func() map[string]interface{} {
+		req, err := http.NewRequest("GET", "/api/capabilities", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newCapabilitiesHandler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+		var rv map[string]interface{}
+		err = json.Unmarshal(rr.Body.Bytes(), &rv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	*highlightFields = "name"
+	*highlightByDefault = true
+	*storeSource = true
+	*synonymsPath = "synonyms.txt"
+	*defaultFuzzyPrefix = 2
+	result := serve()
+	highlighting := result["highlighting"].(map[string]interface{})
+	if highlighting["enabled"] != true || highlighting["by_default"] != true {
+		t.Errorf("expected highlighting on by default, got %v", highlighting)
+	}
+	if fields := highlighting["fields"].([]interface{}); len(fields) != 1 || fields[0] != "name" {
+		t.Errorf("expected highlight fields [name], got %v", fields)
+	}
+	if result["source"] != true || result["synonyms"] != true {
+		t.Errorf("expected source and synonyms enabled, got %v", result)
+	}
+	if prefix := result["fuzzy"].(map[string]interface{})["prefix"]; prefix != 2.0 {
+		t.Errorf("expected fuzzy prefix 2, got %v", prefix)
+	}
+	if result["suggest"] != true {
+		t.Errorf("expected suggest enabled, got %v", result["suggest"])
+	}
+	for _, feature := range []string{"geo", "auth"} {
+		if result[feature] != false {
+			t.Errorf("expected %s disabled, got %v", feature, result[feature])
+		}
+	}
+
+	// by_default means nothing without fields to highlight
+	*highlightFields = ""
+	*storeSource = false
+	*synonymsPath = ""
+	result = serve()
+	highlighting = result["highlighting"].(map[string]interface{})
+	if highlighting["enabled"] != false || highlighting["by_default"] != false {
+		t.Errorf("expected highlighting disabled, got %v", highlighting)
+	}
+	if result["source"] != false || result["synonyms"] != false {
+		t.Errorf("expected source and synonyms disabled, got %v", result)
+	}
+	if result["suggest"] != true {
+		t.Errorf("expected suggest enabled without highlighting, got %v", result["suggest"])
+	}
+}
@@ -0,0 +1,74 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// walkQuery calls visit with each leaf query of q, parsing query strings
+// to visit the clauses they expand to
+func walkQuery(q query.Query, visit func(query.Query)) error {
+	switch q := q.(type) {
+	case nil:
+	case *query.QueryStringQuery:
+		parsed, err := q.Parse()
+		if err != nil {
+			return err
+		}
+		return walkQuery(parsed, visit)
+	case *query.ConjunctionQuery:
+		return walkQueries(q.Conjuncts, visit)
+	case *query.DisjunctionQuery:
+		return walkQueries(q.Disjuncts, visit)
+	case *query.BooleanQuery:
+		return walkQueries([]query.Query{q.Must, q.Should, q.MustNot}, visit)
+	default:
+		visit(q)
+	}
+	return nil
+}
+
+func walkQueries(queries []query.Query, visit func(query.Query)) error {
+	for _, q := range queries {
+		err := walkQuery(q, visit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countClauses returns the number of leaf queries in q
+func countClauses(q query.Query) (int, error) {
+	rv := 0
+	err := walkQuery(q, func(query.Query) {
+		rv++
+	})
+	return rv, err
+}
+
+// checkClauseLimit returns an error when q has more clauses than
+// -maxClauses allows, a limit of 0 disables the check
+func checkClauseLimit(q query.Query) error {
+	if *maxClauses <= 0 {
+		return nil
+	}
+	n, err := countClauses(q)
+	if err != nil {
+		return err
+	}
+	if n > *maxClauses {
+		return fmt.Errorf("query has %d clauses, more than the limit of %d", n, *maxClauses)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+func TestClauseLimit(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("clauseTest", index)
+	defer bleveHttp.UnregisterIndexByName("clauseTest")
+	defer func(orig int) { *maxClauses = orig }(*maxClauses)
+	*maxClauses = 10
+
+	search := func(q query.Query) int {
+		body, err := json.Marshal(bleve.NewSearchRequest(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("POST", "/api/search", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newSearchRequestHandler("clauseTest").ServeHTTP(rr, req)
+		return rr.Code
+	}
+	disjunction := func(n int) *query.DisjunctionQuery {
+		rv := bleve.NewDisjunctionQuery()
+		for i := 0; i < n; i++ {
+			rv.AddQuery(bleve.NewTermQuery(fmt.Sprintf("term%d", i)))
+		}
+		return rv
+	}
+
+	if code := search(disjunction(10)); code != http.StatusOK {
+		t.Errorf("expected a query at the limit to run, got %d", code)
+	}
+	if code := search(disjunction(11)); code != http.StatusBadRequest {
+		t.Errorf("expected a query past the limit to be rejected, got %d", code)
+	}
+
+	// clauses are counted through nesting
+	nested := bleve.NewBooleanQuery()
+	nested.AddMust(disjunction(5))
+	nested.AddMustNot(disjunction(6))
+	if code := search(nested); code != http.StatusBadRequest {
+		t.Errorf("expected a nested query past the limit to be rejected, got %d", code)
+	}
+
+	// the query the GET wrapper builds is limited too
+	code, _ := serveTestSearch(t, "clauseTest", "q=irish+stout+ale&crossFields=name,description")
+	if code != http.StatusOK {
+		t.Errorf("expected a cross-field query within the limit to run, got %d", code)
+	}
+	code, _ = serveTestSearch(t, "clauseTest", "q=a+creamy+irish+red+stout+ale&crossFields=name,description")
+	if code != http.StatusBadRequest {
+		t.Errorf("expected a cross-field query past the limit to be rejected, got %d", code)
+	}
+
+	n, err := countClauses(bleve.NewQueryStringQuery("stout +irish -red name:guinness"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 clauses in query string, got %d", n)
+	}
+}
@@ -0,0 +1,156 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// compareSearchRequest is the body of a compare_search request
+type compareSearchRequest struct {
+	Query     string   `json:"query"`
+	Field     string   `json:"field"`
+	Analyzers []string `json:"analyzers"`
+	Size      int      `json:"size"`
+}
+
+// comparedResult is the outcome of running a query one way
+type comparedResult struct {
+	Total uint64   `json:"total_hits"`
+	IDs   []string `json:"ids"`
+}
+
+// resultOverlap reports how similar two result sets are
+type resultOverlap struct {
+	A       string  `json:"a"`
+	B       string  `json:"b"`
+	Jaccard float64 `json:"jaccard"`
+}
+
+// compareSearchHandler serves POST /api/compare_search, running the same
+// match query with its text analyzed by each of the named analyzers and
+// reporting the result sets side by side, along with the Jaccard similarity
+// of the returned IDs for every pair of analyzers. Only the query text is
+// analyzed differently, the indexed terms are those produced by the field's
+// own analyzer.
+type compareSearchHandler struct {
+	defaultIndexName string
+}
+
+func newCompareSearchHandler(defaultIndexName string) *compareSearchHandler {
+	return &compareSearchHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *compareSearchHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading request body: %v", err), 400)
+		return
+	}
+	var compareRequest compareSearchRequest
+	err = json.Unmarshal(requestBody, &compareRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing request: %v", err), 400)
+		return
+	}
+	if compareRequest.Query == "" {
+		showError(w, req, "query cannot be empty", 400)
+		return
+	}
+	if len(compareRequest.Analyzers) < 2 {
+		showError(w, req, "at least two analyzers are required", 400)
+		return
+	}
+	if compareRequest.Size <= 0 {
+		compareRequest.Size = 10
+	}
+
+	results := make(map[string]comparedResult, len(compareRequest.Analyzers))
+	for _, analyzer := range compareRequest.Analyzers {
+		if index.Mapping().AnalyzerNamed(analyzer) == nil {
+			showError(w, req, fmt.Sprintf("no analyzer named '%s'", analyzer), 400)
+			return
+		}
+		matchQuery := buildMatchQuery(compareRequest.Query, compareRequest.Field)
+		matchQuery.Analyzer = analyzer
+		searchRequest := bleve.NewSearchRequestOptions(withCachedAnalysis(matchQuery, analyses), compareRequest.Size, 0, false)
+		searchResult, err := index.Search(searchRequest)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+			return
+		}
+		ids := make([]string, len(searchResult.Hits))
+		for i, hit := range searchResult.Hits {
+			ids[i] = hit.ID
+		}
+		results[analyzer] = comparedResult{
+			Total: searchResult.Total,
+			IDs:   ids,
+		}
+	}
+
+	var overlap []resultOverlap
+	for i, a := range compareRequest.Analyzers {
+		for _, b := range compareRequest.Analyzers[i+1:] {
+			overlap = append(overlap, resultOverlap{
+				A:       a,
+				B:       b,
+				Jaccard: jaccard(results[a].IDs, results[b].IDs),
+			})
+		}
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"results": results,
+		"overlap": overlap,
+	})
+}
+
+// jaccard returns the size of the intersection of a and b divided by the
+// size of their union, two empty sets are considered identical
+func jaccard(a, b []string) float64 {
+	set := make(map[string]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	union := len(set)
+	intersection := 0
+	seen := make(map[string]bool, len(b))
+	for _, id := range b {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if set[id] {
+			intersection++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 1
+	}
+	return float64(intersection) / float64(union)
+}
@@ -0,0 +1,74 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestCompareSearch(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"lager": map[string]interface{}{"type": "beer", "name": "Brewing Lager"},
+		"ale":   map[string]interface{}{"type": "beer", "name": "Brewed Ale"},
+		"pub":   map[string]interface{}{"type": "beer", "name": "Brew Pub Porter"},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("compareTest", index)
+	defer bleveHttp.UnregisterIndexByName("compareTest")
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/api/compare_search", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newCompareSearchHandler("compareTest").ServeHTTP(rr, req)
+		return rr
+	}
+
+	// the english analyzer stems brewing to brew, matching every document,
+	// the standard analyzer only finds the lager
+	rr := serve(`{"query":"brewing lager","field":"name","analyzers":["en","standard"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result struct {
+		Results map[string]comparedResult `json:"results"`
+		Overlap []resultOverlap           `json:"overlap"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Results["en"].Total != 3 {
+		t.Errorf("expected 3 hits with en, got %d", result.Results["en"].Total)
+	}
+	standard := result.Results["standard"]
+	if standard.Total != 1 || standard.IDs[0] != "lager" {
+		t.Errorf("expected only lager with standard, got %v", standard.IDs)
+	}
+	if len(result.Overlap) != 1 {
+		t.Fatalf("expected 1 overlap entry, got %v", result.Overlap)
+	}
+	if jaccard := result.Overlap[0].Jaccard; jaccard < 0.333 || jaccard > 0.334 {
+		t.Errorf("expected jaccard similarity 1/3, got %f", jaccard)
+	}
+
+	rr = serve(`{"query":"brewing","analyzers":["en","nope"]}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown analyzer, got %d", rr.Code)
+	}
+}
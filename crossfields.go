@@ -0,0 +1,93 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// breweryField holds a searchable form of a beer's brewery_id, such as
+// "dogfish head craft brewery" for dogfish_head_craft_brewery
+const breweryField = "brewery"
+
+// deriveBrewery sets the brewery field of beers from their brewery_id,
+// unless they already have one
+func deriveBrewery(jsonDoc interface{}) {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok || doc["type"] != "beer" {
+		return
+	}
+	if _, ok := doc[breweryField]; ok {
+		return
+	}
+	if breweryID, ok := doc[breweryIDField].(string); ok {
+		doc[breweryField] = strings.Replace(breweryID, "_", " ", -1)
+	}
+}
+
+// crossField is a field searched by a cross-field query, with the boost
+// applied to its matches
+type crossField struct {
+	name  string
+	boost float64
+}
+
+// parseCrossFields parses a comma separated list of fields, each optionally
+// followed by ^boost, such as "name^2,brewery"
+func parseCrossFields(spec string) ([]crossField, error) {
+	var rv []crossField
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field := crossField{name: part, boost: 1}
+		if i := strings.LastIndex(part, "^"); i >= 0 {
+			boost, err := strconv.ParseFloat(part[i+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid boost in '%s': %v", part, err)
+			}
+			field.name, field.boost = part[:i], boost
+		}
+		if field.name == "" {
+			return nil, fmt.Errorf("missing field name in '%s'", part)
+		}
+		rv = append(rv, field)
+	}
+	if len(rv) == 0 {
+		return nil, fmt.Errorf("no fields to search")
+	}
+	return rv, nil
+}
+
+// buildCrossFieldsQuery matches q as if fields were one logical field: every
+// term of q must match, but each may match in any of the fields. A query for
+// "dogfish 60" thus finds a beer named 60 Minute IPA from Dogfish Head,
+// although neither field matches both terms. Each term scores by the fields
+// it matches in, weighted by their boosts, and scores add up across terms.
+func buildCrossFieldsQuery(q string, fields []crossField) query.Query {
+	terms := strings.Fields(q)
+	termQueries := make([]query.Query, 0, len(terms))
+	for _, term := range terms {
+		fieldQueries := make([]query.Query, 0, len(fields))
+		for _, field := range fields {
+			fieldQuery := buildMatchQuery(term, field.name)
+			fieldQuery.SetBoost(field.boost)
+			fieldQueries = append(fieldQueries, fieldQuery)
+		}
+		termQueries = append(termQueries, bleve.NewDisjunctionQuery(fieldQueries...))
+	}
+	return bleve.NewConjunctionQuery(termQueries...)
+}
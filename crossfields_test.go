@@ -0,0 +1,75 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestCrossFields(t *testing.T) {
+	docs := map[string]interface{}{
+		"dogfish-60": map[string]interface{}{
+			"type":       "beer",
+			"name":       "60 Minute IPA",
+			"brewery_id": "dogfish_head_craft_brewery",
+		},
+		"dogfish-90": map[string]interface{}{
+			"type":       "beer",
+			"name":       "90 Minute IPA",
+			"brewery_id": "dogfish_head_craft_brewery",
+		},
+		"shilling-60": map[string]interface{}{
+			"type":       "beer",
+			"name":       "60 Shilling Ale",
+			"brewery_id": "caledonian_brewery",
+		},
+	}
+	for _, doc := range docs {
+		deriveBrewery(doc)
+	}
+	if brewery := docs["dogfish-60"].(map[string]interface{})[breweryField]; brewery != "dogfish head craft brewery" {
+		t.Fatalf("expected brewery derived from brewery_id, got %v", brewery)
+	}
+	index := newTestIndex(t, docs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("crossFieldsTest", index)
+	defer bleveHttp.UnregisterIndexByName("crossFieldsTest")
+
+	hitIDs := func(result map[string]interface{}) []string {
+		ids := []string{}
+		for _, hit := range result["hits"].([]interface{}) {
+			ids = append(ids, hit.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+
+	// neither field holds both terms, but together they do, and only the
+	// one beer has both
+	_, result := serveTestSearch(t, "crossFieldsTest", "q=dogfish+60&crossFields=name,brewery")
+	if ids := hitIDs(result); !reflect.DeepEqual(ids, []string{"dogfish-60"}) {
+		t.Errorf("expected [dogfish-60], got %v", ids)
+	}
+
+	// boosts are accepted per field
+	_, result = serveTestSearch(t, "crossFieldsTest", "q=ipa+dogfish&crossFields=name^2,brewery")
+	if ids := hitIDs(result); len(ids) != 2 {
+		t.Errorf("expected both dogfish beers, got %v", ids)
+	}
+
+	for _, spec := range []string{"name^x", ",", "^2"} {
+		if code, _ := serveTestSearch(t, "crossFieldsTest", "q=dogfish&crossFields="+spec); code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for crossFields=%s, got %d", spec, code)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve/search"
+)
+
+// Freshness decay multiplies the score of each hit by a factor falling from
+// 1 to 0 as the document's updated time moves away from an origin, by
+// default the time of the search. Ages up to offset keep a factor of 1,
+// and at offset+scale the factor has fallen to value. The curves differ in
+// how they get there:
+//
+//	linear  falls in a straight line, reaching 0 at offset+scale/(1-value)
+//	        and staying there
+//	exp     falls by the same proportion for every unit of age, quickest
+//	        for the freshest documents, never reaching 0
+//	gauss   falls slowly at first, then quickly around scale, then slowly
+//	        again, never reaching 0
+//
+// Documents without a parseable updated time keep their score.
+
+// decayField holds the time freshness is measured from
+const decayField = "updated"
+
+// decayTimeLayouts are the forms updated times are read in, stored date
+// times come back as RFC3339, the source documents use the second form
+var decayTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05"}
+
+// decayFunction scores hits by the age of their updated time
+type decayFunction struct {
+	curve  string
+	origin time.Time
+	offset time.Duration
+	scale  time.Duration
+	value  float64
+}
+
+// parseDecay reads a decay function from the decay, decayScale,
+// decayOffset, decayValue and decayOrigin parameters of req, returning nil
+// without decay. now is the default origin.
+func parseDecay(req *http.Request, now time.Time) (*decayFunction, error) {
+	curve := req.FormValue("decay")
+	if curve == "" {
+		return nil, nil
+	}
+	if curve != "linear" && curve != "exp" && curve != "gauss" {
+		return nil, fmt.Errorf("unknown decay '%s', expected linear, exp or gauss", curve)
+	}
+	rv := &decayFunction{
+		curve:  curve,
+		origin: now,
+		value:  0.5,
+	}
+
+	scaleParam := req.FormValue("decayScale")
+	if scaleParam == "" {
+		return nil, fmt.Errorf("decay requires decayScale")
+	}
+	var err error
+	rv.scale, err = time.ParseDuration(scaleParam)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing decayScale: %v", err)
+	}
+	if rv.scale <= 0 {
+		return nil, fmt.Errorf("decayScale must be positive")
+	}
+	if offsetParam := req.FormValue("decayOffset"); offsetParam != "" {
+		rv.offset, err = time.ParseDuration(offsetParam)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing decayOffset: %v", err)
+		}
+		if rv.offset < 0 {
+			return nil, fmt.Errorf("decayOffset cannot be negative")
+		}
+	}
+	if valueParam := req.FormValue("decayValue"); valueParam != "" {
+		rv.value, err = strconv.ParseFloat(valueParam, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing decayValue: %v", err)
+		}
+		if rv.value <= 0 || rv.value >= 1 {
+			return nil, fmt.Errorf("decayValue must be between 0 and 1 exclusive")
+		}
+	}
+	if originParam := req.FormValue("decayOrigin"); originParam != "" {
+		rv.origin, err = time.Parse(time.RFC3339, originParam)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing decayOrigin: %v", err)
+		}
+	}
+	return rv, nil
+}
+
+// factor returns the multiplier for the score of a document updated at t
+func (d *decayFunction) factor(t time.Time) float64 {
+	age := d.origin.Sub(t)
+	if age < 0 {
+		age = -age
+	}
+	age -= d.offset
+	if age <= 0 {
+		return 1
+	}
+	// age in units of scale
+	x := float64(age) / float64(d.scale)
+	switch d.curve {
+	case "linear":
+		return math.Max(0, 1-x*(1-d.value))
+	case "exp":
+		return math.Pow(d.value, x)
+	case "gauss":
+		return math.Pow(d.value, x*x)
+	}
+	return 1
+}
+
+// decayHits multiplies the score of each hit by its decay factor, then
+// reorders the hits by score
+func decayHits(hits search.DocumentMatchCollection, d *decayFunction) {
+	for _, hit := range hits {
+		if t, ok := parseDecayTime(hit.Fields[decayField]); ok {
+			hit.Score *= d.factor(t)
+		}
+	}
+	sort.Stable(hits)
+}
+
+func parseDecayTime(v interface{}) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range decayTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
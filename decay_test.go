@@ -0,0 +1,183 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/search"
+)
+
+var decayTestOrigin = time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const decayTestDay = 24 * time.Hour
+
+func TestDecayFactor(t *testing.T) {
+	for _, curve := range []string{"linear", "exp", "gauss"} {
+		d := &decayFunction{
+			curve:  curve,
+			origin: decayTestOrigin,
+			offset: decayTestDay,
+			scale:  10 * decayTestDay,
+			value:  0.25,
+		}
+		// within the offset, in either direction, nothing decays
+		for _, age := range []time.Duration{0, decayTestDay, -decayTestDay} {
+			if f := d.factor(decayTestOrigin.Add(-age)); f != 1 {
+				t.Errorf("%s: expected factor 1 at age %v, got %f", curve, age, f)
+			}
+		}
+		if f := d.factor(decayTestOrigin.Add(-11 * decayTestDay)); math.Abs(f-0.25) > 1e-9 {
+			t.Errorf("%s: expected factor 0.25 at offset+scale, got %f", curve, f)
+		}
+	}
+
+	linear := &decayFunction{curve: "linear", origin: decayTestOrigin, scale: 10 * decayTestDay, value: 0.5}
+	if f := linear.factor(decayTestOrigin.Add(-25 * decayTestDay)); f != 0 {
+		t.Errorf("linear: expected factor 0 past scale/(1-value), got %f", f)
+	}
+}
+
+func TestDecayCurvesOrdering(t *testing.T) {
+	// the same dated hits, the older ones more relevant
+	newHits := func() search.DocumentMatchCollection {
+		hit := func(id string, score float64, age time.Duration) *search.DocumentMatch {
+			return &search.DocumentMatch{
+				ID:    id,
+				Score: score,
+				Fields: map[string]interface{}{
+					decayField: decayTestOrigin.Add(-age).Format(time.RFC3339),
+				},
+			}
+		}
+		return search.DocumentMatchCollection{
+			hit("oldest", 3.0, 20*decayTestDay),
+			hit("old", 1.0, 15*decayTestDay),
+			hit("recent", 1.0, 5*decayTestDay),
+			hit("fresh", 0.8, 0),
+			{ID: "undated", Score: 0.5},
+		}
+	}
+
+	tests := []struct {
+		curve  string
+		expect []string
+	}{
+		// exp falls fastest at first, so fresh beats recent, while the long
+		// tail keeps the highly relevant oldest above both old and recent
+		{"exp", []string{"fresh", "oldest", "recent", "undated", "old"}},
+		// gauss barely touches recent, then falls steeply
+		{"gauss", []string{"recent", "fresh", "undated", "old", "oldest"}},
+		// linear reaches 0 at twice the scale
+		{"linear", []string{"fresh", "recent", "undated", "old", "oldest"}},
+	}
+	for _, test := range tests {
+		hits := newHits()
+		decayHits(hits, &decayFunction{
+			curve:  test.curve,
+			origin: decayTestOrigin,
+			scale:  10 * decayTestDay,
+			value:  0.5,
+		})
+		var ids []string
+		for _, hit := range hits {
+			ids = append(ids, hit.ID)
+		}
+		if !reflect.DeepEqual(ids, test.expect) {
+			t.Errorf("%s: expected %v, got %v", test.curve, test.expect, ids)
+		}
+	}
+}
+
+func TestSearchDecay(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"ale-2010": map[string]interface{}{
+			"type":    "beer",
+			"name":    "Pale Ale",
+			"updated": "2010-01-01 00:00:00",
+		},
+		"ale-2011": map[string]interface{}{
+			"type":    "beer",
+			"name":    "Pale Ale",
+			"updated": "2011-12-01 00:00:00",
+		},
+		"ale-2009": map[string]interface{}{
+			"type":    "beer",
+			"name":    "Pale Ale",
+			"updated": "2009-01-01 00:00:00",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("decayTest", index)
+	defer bleveHttp.UnregisterIndexByName("decayTest")
+
+	for _, curve := range []string{"linear", "exp", "gauss"} {
+		code, result := serveTestSearch(t, "decayTest",
+			"q=pale&field=name&decay="+curve+"&decayScale=17520h&decayOrigin=2012-01-01T00:00:00Z")
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", curve, code)
+		}
+		var ids []string
+		for _, hit := range result["hits"].([]interface{}) {
+			ids = append(ids, hit.(map[string]interface{})["id"].(string))
+		}
+		expect := []string{"ale-2011", "ale-2010", "ale-2009"}
+		if !reflect.DeepEqual(ids, expect) {
+			t.Errorf("%s: expected newest first %v, got %v", curve, expect, ids)
+		}
+	}
+
+	// only decay from a fixed origin can be revalidated
+	for _, test := range []struct {
+		params    string
+		cacheable bool
+	}{
+		{"decay=exp&decayScale=17520h&decayOrigin=2012-01-01T00:00:00Z", true},
+		{"decay=exp&decayScale=17520h", false},
+	} {
+		req, err := http.NewRequest("GET", "/api/search?q=pale&"+test.params, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newSearchQueryHandler("decayTest").ServeHTTP(rr, req)
+		etag := rr.Header().Get("ETag")
+		if (etag != "") != test.cacheable {
+			t.Errorf("%s: expected an ETag %t, got %q", test.params, test.cacheable, etag)
+		}
+		req.Header.Set("If-None-Match", searchETag("GET "+req.URL.Query().Encode()))
+		rr = httptest.NewRecorder()
+		newSearchQueryHandler("decayTest").ServeHTTP(rr, req)
+		if (rr.Code == http.StatusNotModified) != test.cacheable {
+			t.Errorf("%s: expected a 304 %t, got status %d", test.params, test.cacheable, rr.Code)
+		}
+	}
+
+	invalid := []string{
+		"decay=cubic&decayScale=24h",
+		"decay=exp",
+		"decay=exp&decayScale=-24h",
+		"decay=exp&decayScale=24h&decayOffset=-1h",
+		"decay=exp&decayScale=24h&decayValue=1",
+		"decay=exp&decayScale=24h&decayOrigin=yesterday",
+		"decay=exp&decayScale=24h&sort=name",
+	}
+	for _, params := range invalid {
+		if code, _ := serveTestSearch(t, "decayTest", "q=pale&"+params); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", params, code)
+		}
+	}
+}
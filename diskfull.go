@@ -0,0 +1,83 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"expvar"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+// diskFull is set while indexing is held up by a full disk, and published
+// as the disk_full expvar
+var diskFull int32
+
+func init() {
+	expvar.Publish("disk_full", expvar.Func(func() interface{} {
+		return atomic.LoadInt32(&diskFull) != 0
+	}))
+}
+
+// diskFullRetryInterval is how long indexing waits before retrying a batch
+// that failed for lack of space
+var diskFullRetryInterval = 30 * time.Second
+
+// isDiskFull reports whether err is the error of a write that ran out of
+// space. Errors bleve only passes on as text are recognized by their
+// message.
+func isDiskFull(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case syscall.Errno:
+		return e == syscall.ENOSPC
+	case *os.PathError:
+		return isDiskFull(e.Err)
+	case *os.SyscallError:
+		return isDiskFull(e.Err)
+	}
+	return strings.Contains(err.Error(), syscall.ENOSPC.Error())
+}
+
+// commitBatch adds docs to batch and applies it to i, see indexSequenced.
+// A batch failing because the disk is full
+// is retried every diskFullRetryInterval, with diskFull set, until it
+// succeeds, stop returns true, or with stop nil, indefinitely. Pausing
+// indexing also holds up the retries, until stop returns true.
+func commitBatch(i bleve.Index, batch *bleve.Batch, docs []pendingDoc, stop func() bool) error {
+	for {
+		err := indexSequenced(i, batch, docs)
+		if !isDiskFull(err) {
+			if err == nil && atomic.CompareAndSwapInt32(&diskFull, 1, 0) {
+				log.Printf("disk space available again, indexing resumed")
+			}
+			return err
+		}
+		if atomic.CompareAndSwapInt32(&diskFull, 0, 1) {
+			log.Printf("disk full, indexing paused, retrying every %v: %v", diskFullRetryInterval, err)
+		}
+		// giving up, nothing is waiting on the disk any more
+		if stop != nil && stop() {
+			atomic.StoreInt32(&diskFull, 0)
+			return err
+		}
+		time.Sleep(diskFullRetryInterval)
+		if !indexingPause.wait(stop) {
+			atomic.StoreInt32(&diskFull, 0)
+			return err
+		}
+	}
+}
@@ -0,0 +1,255 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// wrappedIndex lets a test index embed a bleve.Index, whose Index method
+// would otherwise clash with the name of the embedded field
+type wrappedIndex interface {
+	bleve.Index
+}
+
+// diskFullTestIndex fails batches as a full disk would while full is set
+type diskFullTestIndex struct {
+	wrappedIndex
+	full     int32
+	attempts int32
+}
+
+func (i *diskFullTestIndex) Batch(b *bleve.Batch) error {
+	atomic.AddInt32(&i.attempts, 1)
+	if atomic.LoadInt32(&i.full) != 0 {
+		return &os.PathError{Op: "write", Path: "store", Err: syscall.ENOSPC}
+	}
+	return i.wrappedIndex.Batch(b)
+}
+
+func TestIsDiskFull(t *testing.T) {
+	tests := []struct {
+		err    error
+		expect bool
+	}{
+		{nil, false},
+		{syscall.ENOSPC, true},
+		{&os.PathError{Op: "write", Path: "store", Err: syscall.ENOSPC}, true},
+		{os.NewSyscallError("fsync", syscall.ENOSPC), true},
+		{fmt.Errorf("error persisting segment: %v", syscall.ENOSPC), true},
+		{syscall.EACCES, false},
+		{fmt.Errorf("batch failed"), false},
+	}
+	for _, test := range tests {
+		if actual := isDiskFull(test.err); actual != test.expect {
+			t.Errorf("%v: expected %t, got %t", test.err, test.expect, actual)
+		}
+	}
+}
+
+func TestIndexingDiskFull(t *testing.T) {
+	defer func(orig time.Duration) { diskFullRetryInterval = orig }(diskFullRetryInterval)
+	diskFullRetryInterval = time.Millisecond
+	defer atomic.StoreInt32(&diskFull, 0)
+
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"light.json":  `{"type":"beer","name":"Light"}`,
+		"barley.json": `{"type":"beer","name":"Barley Wine"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	index := &diskFullTestIndex{
+		wrappedIndex: newTestIndex(t, nil),
+		full:         1,
+	}
+	defer index.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- indexBeer(index)
+	}()
+
+	// indexing keeps retrying rather than failing
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&index.attempts) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for retries")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("expected indexing to wait for space, it returned %v", err)
+	default:
+	}
+
+	// the degraded state is reported, without failing readiness
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newReadyzHandler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected readyz 200 while the disk is full, got %d", rr.Code)
+	}
+	var readyz map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &readyz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readyz["disk_full"] != true {
+		t.Errorf("expected readyz to report disk_full, got %v", readyz)
+	}
+	if full := expvar.Get("disk_full").String(); full != "true" {
+		t.Errorf("expected the disk_full expvar true, got %s", full)
+	}
+
+	// and cleared once a retry succeeds
+	atomic.StoreInt32(&index.full, 0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for indexing to finish")
+	}
+	if full := expvar.Get("disk_full").String(); full != "false" {
+		t.Errorf("expected the disk_full expvar false, got %s", full)
+	}
+	count, err := index.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 documents indexed, got %d", count)
+	}
+}
+
+func TestDocIndexDiskFull(t *testing.T) {
+	index := &diskFullTestIndex{
+		wrappedIndex: newTestIndex(t, nil),
+		full:         1,
+	}
+	defer index.Close()
+	bleveHttp.RegisterIndexName("diskFullTest", index)
+	defer bleveHttp.UnregisterIndexByName("diskFullTest")
+
+	handler := newDocIndexHandler("diskFullTest")
+	handler.DocIDLookup = func(*http.Request) string { return "porter" }
+	req, err := http.NewRequest("PUT", "/api/doc/porter",
+		strings.NewReader(`{"type":"beer","name":"Porter"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Errorf("expected status 507, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReindexBoundedLastBatchDiskFull(t *testing.T) {
+	defer func(orig time.Duration) { diskFullRetryInterval = orig }(diskFullRetryInterval)
+	diskFullRetryInterval = time.Millisecond
+	defer atomic.StoreInt32(&diskFull, 0)
+
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"stout.json": `{"type":"beer","name":"Stout"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	index := &diskFullTestIndex{
+		wrappedIndex: newTestIndex(t, nil),
+		full:         1,
+	}
+	defer index.Close()
+	bleveHttp.RegisterIndexName("diskFullTest", index)
+	defer bleveHttp.UnregisterIndexByName("diskFullTest")
+
+	req, err := http.NewRequest("POST", "/api/reindex?maxDuration=1500ms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := newReindexHandler("diskFullTest")
+	clock := time.Unix(0, 0)
+	handler.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rr, req)
+		close(done)
+	}()
+
+	// the final batch gives up at the deadline like any other
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the last batch to stop retrying at the deadline")
+	}
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Errorf("expected status 507, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if atomic.LoadInt32(&reindexing) != 0 {
+		t.Error("expected the reindex guard to be released")
+	}
+	if full := expvar.Get("disk_full").String(); full != "false" {
+		t.Errorf("expected the disk_full expvar cleared once indexing gave up, got %s", full)
+	}
+}
+
+func TestCommitBatchDiskFullWhilePaused(t *testing.T) {
+	defer func(orig time.Duration) { diskFullRetryInterval = orig }(diskFullRetryInterval)
+	diskFullRetryInterval = time.Millisecond
+	defer func(orig time.Duration) { indexingGatePollInterval = orig }(indexingGatePollInterval)
+	indexingGatePollInterval = time.Millisecond
+	defer atomic.StoreInt32(&diskFull, 0)
+	defer indexingPause.setPaused(false)
+	indexingPause.setPaused(true)
+
+	index := &diskFullTestIndex{
+		wrappedIndex: newTestIndex(t, nil),
+		full:         1,
+	}
+	defer index.Close()
+
+	// the deadline passes while waiting out the pause
+	calls := 0
+	stop := func() bool {
+		calls++
+		return calls > 1
+	}
+	err := commitBatch(index, index.NewBatch(), nil, stop)
+	if !isDiskFull(err) {
+		t.Fatalf("expected a disk full error, got %v", err)
+	}
+	if full := expvar.Get("disk_full").String(); full != "false" {
+		t.Errorf("expected the disk_full expvar cleared once indexing gave up, got %s", full)
+	}
+}
@@ -0,0 +1,103 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// docIndexHandler serves PUT /api/doc/{docID}, indexing the JSON request
+// body through the same preparation steps as indexBeer. Only a missing id
+// or a body that is not JSON is the client's fault, failures preparing or
+// indexing the document are 500s.
+type docIndexHandler struct {
+	defaultIndexName string
+	DocIDLookup      func(req *http.Request) string
+}
+
+func newDocIndexHandler(defaultIndexName string) *docIndexHandler {
+	return &docIndexHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *docIndexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	// find the doc id
+	var docID string
+	if h.DocIDLookup != nil {
+		docID = h.DocIDLookup(req)
+	}
+	if docID == "" {
+		showError(w, req, "document id cannot be empty", 400)
+		return
+	}
+
+	// read the request body
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading request body: %v", err), 400)
+		return
+	}
+
+	// parse request body as json
+	var jsonDoc interface{}
+	err = json.Unmarshal(requestBody, &jsonDoc)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing request body as JSON: %v", err), 400)
+		return
+	}
+
+	ok, err := prepareDocument(docID, jsonDoc)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error preparing document '%s': %v", docID, err), 500)
+		return
+	}
+	if !ok {
+		showError(w, req, fmt.Sprintf("document '%s' was skipped", docID), 422)
+		return
+	}
+	if *storeSource {
+		contentType := req.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		storeDocumentSource(jsonDoc, requestBody, contentType)
+	}
+	err = indexSequenced(index, index.NewBatch(), []pendingDoc{{id: docID, doc: jsonDoc}})
+	if isDiskFull(err) {
+		showError(w, req, fmt.Sprintf("disk full, cannot index document '%s': %v", docID, err), 507)
+		return
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error indexing document '%s': %v", docID, err), 500)
+		return
+	}
+	bumpIndexVersion()
+	indexRate.add(1)
+
+	rv := struct {
+		Status string `json:"status"`
+	}{
+		Status: "ok",
+	}
+	mustEncode(w, rv)
+}
@@ -0,0 +1,158 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// seqField holds a sequence number stamped on every document as it is
+// indexed, increasing with each index operation
+const seqField = "_seq"
+
+// seqInternalKey is the internal storage key persisting the last sequence
+// number handed out, so numbering resumes after a restart
+var seqInternalKey = []byte("_seq")
+
+var lastSeq uint64
+
+// loadSequence restores the sequence counter from the index
+func loadSequence(i bleve.Index) error {
+	val, err := i.GetInternal(seqInternalKey)
+	if err != nil {
+		return err
+	}
+	if len(val) == 8 {
+		atomic.StoreUint64(&lastSeq, binary.BigEndian.Uint64(val))
+	}
+	return nil
+}
+
+// seqLock serializes handing out sequence numbers with applying the batches
+// holding them, so numbers become visible in the order they were handed out
+// and an export cursor can never pass a document still to be committed
+var seqLock sync.Mutex
+
+// pendingDoc is a prepared document waiting for its sequence number, it is
+// only added to its batch as the batch is committed
+type pendingDoc struct {
+	id  string
+	doc interface{}
+}
+
+// indexSequenced stamps each of docs with the next sequence number, adds it
+// to batch, and applies batch to i, recording the last number handed out in
+// the batch so it is persisted along with the documents. The counter only
+// advances once the batch is applied, a failed batch can simply be retried.
+func indexSequenced(i bleve.Index, batch *bleve.Batch, docs []pendingDoc) error {
+	seqLock.Lock()
+	defer seqLock.Unlock()
+	seq := atomic.LoadUint64(&lastSeq)
+	for _, pending := range docs {
+		if doc, ok := pending.doc.(map[string]interface{}); ok {
+			seq++
+			doc[seqField] = float64(seq)
+		}
+		// indexing an id already in the batch replaces it, so retries
+		// restamp the same documents
+		err := batch.Index(pending.id, pending.doc)
+		if err != nil {
+			return err
+		}
+	}
+	if seq != atomic.LoadUint64(&lastSeq) {
+		val := make([]byte, 8)
+		binary.BigEndian.PutUint64(val, seq)
+		batch.SetInternal(seqInternalKey, val)
+	}
+	err := i.Batch(batch)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(&lastSeq, seq)
+	return nil
+}
+
+// exportHandler serves GET /api/export?since=<cursor>, returning the stored
+// fields of documents indexed or updated after cursor, oldest first, along
+// with the cursor to pass to the next call. Omitting since exports
+// everything. Deletions are not reported.
+type exportHandler struct {
+	defaultIndexName string
+}
+
+func newExportHandler(defaultIndexName string) *exportHandler {
+	return &exportHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *exportHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	var since uint64
+	if sinceParam := req.FormValue("since"); sinceParam != "" {
+		var err error
+		since, err = strconv.ParseUint(sinceParam, 10, 64)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error parsing since: %v", err), 400)
+			return
+		}
+	}
+	size, err := intParam(req, "size", 1000)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+
+	min := float64(since)
+	minInclusive := false
+	seqQuery := bleve.NewNumericRangeInclusiveQuery(&min, nil, &minInclusive, nil)
+	seqQuery.SetField(seqField)
+	searchRequest := bleve.NewSearchRequestOptions(seqQuery, size, 0, false)
+	searchRequest.SortBy([]string{seqField})
+	searchRequest.Fields = []string{"*"}
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+
+	cursor := since
+	documents := make([]map[string]interface{}, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		if seq, ok := hit.Fields[seqField].(float64); ok && uint64(seq) > cursor {
+			cursor = uint64(seq)
+		}
+		documents = append(documents, map[string]interface{}{
+			"id":     hit.ID,
+			"fields": hit.Fields,
+		})
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"documents": documents,
+		"cursor":    strconv.FormatUint(cursor, 10),
+		"more":      searchResult.Total > uint64(len(searchResult.Hits)),
+	})
+}
@@ -0,0 +1,151 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+type exportResult struct {
+	Documents []struct {
+		ID     string                 `json:"id"`
+		Fields map[string]interface{} `json:"fields"`
+	} `json:"documents"`
+	Cursor string `json:"cursor"`
+}
+
+func serveTestExport(t *testing.T, indexName, since string) exportResult {
+	req, err := http.NewRequest("GET", "/api/export?since="+since, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newExportHandler(indexName).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var rv exportResult
+	err = json.Unmarshal(rr.Body.Bytes(), &rv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+func TestIncrementalExport(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"pale.json":  `{"type":"beer","name":"Pale Ale"}`,
+		"stout.json": `{"type":"beer","name":"Stout"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err := indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bleveHttp.RegisterIndexName("exportTest", index)
+	defer bleveHttp.UnregisterIndexByName("exportTest")
+
+	full := serveTestExport(t, "exportTest", "")
+	if len(full.Documents) != 2 {
+		t.Fatalf("expected 2 documents in full export, got %d", len(full.Documents))
+	}
+
+	// nothing changed, nothing to export
+	unchanged := serveTestExport(t, "exportTest", full.Cursor)
+	if len(unchanged.Documents) != 0 {
+		t.Errorf("expected no documents, got %v", unchanged.Documents)
+	}
+	if unchanged.Cursor != full.Cursor {
+		t.Errorf("expected cursor to stay at %s, got %s", full.Cursor, unchanged.Cursor)
+	}
+
+	// update one document
+	doc := map[string]interface{}{"type": "beer", "name": "Imperial Stout"}
+	err = indexSequenced(index, index.NewBatch(), []pendingDoc{{id: "stout", doc: doc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incremental := serveTestExport(t, "exportTest", full.Cursor)
+	if len(incremental.Documents) != 1 || incremental.Documents[0].ID != "stout" {
+		t.Fatalf("expected only stout in incremental export, got %v", incremental.Documents)
+	}
+	if incremental.Documents[0].Fields["name"] != "Imperial Stout" {
+		t.Errorf("expected updated name, got %v", incremental.Documents[0].Fields["name"])
+	}
+	if incremental.Cursor == full.Cursor {
+		t.Errorf("expected cursor to advance past %s", full.Cursor)
+	}
+
+	// a document prepared earlier but committed later is numbered after
+	// those committed before it, so exports past them still find it
+	late := map[string]interface{}{"type": "beer", "name": "Late Lager"}
+	early := map[string]interface{}{"type": "beer", "name": "Early Porter"}
+	err = indexSequenced(index, index.NewBatch(), []pendingDoc{{id: "porter", doc: early}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterEarly := serveTestExport(t, "exportTest", incremental.Cursor)
+	if len(afterEarly.Documents) != 1 || afterEarly.Documents[0].ID != "porter" {
+		t.Fatalf("expected only porter, got %v", afterEarly.Documents)
+	}
+	err = indexSequenced(index, index.NewBatch(), []pendingDoc{{id: "lager", doc: late}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterLate := serveTestExport(t, "exportTest", afterEarly.Cursor)
+	if len(afterLate.Documents) != 1 || afterLate.Documents[0].ID != "lager" {
+		t.Fatalf("expected the later commit in the next export, got %v", afterLate.Documents)
+	}
+	incremental = afterLate
+
+	// a failed batch hands out no numbers
+	failing := &diskFullTestIndex{wrappedIndex: index, full: 1}
+	before := lastSeq
+	err = indexSequenced(failing, index.NewBatch(), []pendingDoc{{id: "ale", doc: map[string]interface{}{"type": "beer"}}})
+	if err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+	if lastSeq != before {
+		t.Errorf("expected the sequence to stay at %d, got %d", before, lastSeq)
+	}
+
+	// the sequence survives a reload from the index
+	lastSeq = 0
+	err = loadSequence(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incremental.Cursor != strconv.FormatUint(lastSeq, 10) {
+		t.Errorf("expected reloaded sequence %s, got %d", incremental.Cursor, lastSeq)
+	}
+
+	// negative sizes are rejected
+	req, err := http.NewRequest("GET", "/api/export?size=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newExportHandler("exportTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a negative size, got %d", rr.Code)
+	}
+}
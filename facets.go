@@ -0,0 +1,89 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// facetCount is a single facet value and the number of documents holding it
+type facetCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// relatedTagsHandler serves GET /api/related_tags?tag=, returning the tags
+// most frequently found on documents that also carry tag
+type relatedTagsHandler struct {
+	defaultIndexName string
+}
+
+func newRelatedTagsHandler(defaultIndexName string) *relatedTagsHandler {
+	return &relatedTagsHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *relatedTagsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	tag := req.FormValue("tag")
+	if tag == "" {
+		showError(w, req, "missing required parameter 'tag'", 400)
+		return
+	}
+	size, err := intParam(req, "size", 10)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+
+	tagQuery := bleve.NewTermQuery(tag)
+	tagQuery.SetField("tags")
+	fieldUsage.record(tagQuery)
+	searchRequest := bleve.NewSearchRequestOptions(tagQuery, 0, 0, false)
+	// every matching document carries the input tag, ask for one extra
+	// bucket so excluding it still leaves size results
+	searchRequest.AddFacet("tags", bleve.NewFacetRequest("tags", size+1))
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+
+	related := []facetCount{}
+	for _, termFacet := range searchResult.Facets["tags"].Terms {
+		if termFacet.Term == tag {
+			continue
+		}
+		if len(related) >= size {
+			break
+		}
+		related = append(related, facetCount{
+			Term:  termFacet.Term,
+			Count: termFacet.Count,
+		})
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"tag":   tag,
+		"total": searchResult.Total,
+		"tags":  related,
+	})
+}
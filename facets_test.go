@@ -0,0 +1,72 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestRelatedTags(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"a": map[string]interface{}{"type": "beer", "tags": []string{"hoppy", "bitter", "west-coast"}},
+		"b": map[string]interface{}{"type": "beer", "tags": []string{"hoppy", "bitter"}},
+		"c": map[string]interface{}{"type": "beer", "tags": []string{"hoppy", "citrus"}},
+		"d": map[string]interface{}{"type": "beer", "tags": []string{"malty", "bitter"}},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("relatedTagsTest", index)
+	defer bleveHttp.UnregisterIndexByName("relatedTagsTest")
+
+	req, err := http.NewRequest("GET", "/api/related_tags?tag=hoppy&size=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newRelatedTagsHandler("relatedTagsTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var result struct {
+		Total uint64       `json:"total"`
+		Tags  []facetCount `json:"tags"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 {
+		t.Errorf("expected 3 documents tagged hoppy, got %d", result.Total)
+	}
+	expected := []facetCount{
+		{Term: "bitter", Count: 2},
+		{Term: "citrus", Count: 1},
+	}
+	if !reflect.DeepEqual(result.Tags, expected) {
+		t.Errorf("expected related tags %v, got %v", expected, result.Tags)
+	}
+
+	// negative sizes are rejected
+	req, err = http.NewRequest("GET", "/api/related_tags?tag=hoppy&size=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	newRelatedTagsHandler("relatedTagsTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a negative size, got %d", rr.Code)
+	}
+}
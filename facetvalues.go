@@ -0,0 +1,112 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// facetValuesHandler serves GET /api/facet_values/{field}?from=&size=,
+// returning a page of the values indexed in field with the number of
+// documents holding each, most frequent first and ties by value. Unlike a
+// terms facet, which only returns the top values, every value can be paged
+// through. Counts come from the field dictionary, so they cover the whole
+// index rather than the results of a search, and with scorch may include
+// deleted documents until their segments are merged away.
+type facetValuesHandler struct {
+	defaultIndexName string
+	FieldLookup      func(req *http.Request) string
+}
+
+func newFacetValuesHandler(defaultIndexName string) *facetValuesHandler {
+	return &facetValuesHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *facetValuesHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	var field string
+	if h.FieldLookup != nil {
+		field = h.FieldLookup(req)
+	}
+	if field == "" {
+		showError(w, req, "field cannot be empty", 400)
+		return
+	}
+	from, err := intParam(req, "from", 0)
+	if err != nil || from < 0 {
+		showError(w, req, fmt.Sprintf("invalid from '%s'", req.FormValue("from")), 400)
+		return
+	}
+	size, err := intParam(req, "size", 10)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+
+	dict, err := index.FieldDict(aliasField(field))
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading field dictionary: %v", err), 500)
+		return
+	}
+	defer dict.Close()
+	values := []facetCount{}
+	entry, err := dict.Next()
+	for err == nil && entry != nil {
+		values = append(values, facetCount{
+			Term:  entry.Term,
+			Count: int(entry.Count),
+		})
+		entry, err = dict.Next()
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading field dictionary: %v", err), 500)
+		return
+	}
+
+	sort.Sort(facetCountsByCount(values))
+	total := len(values)
+	if from > total {
+		from = total
+	}
+	end := from + size
+	if end > total {
+		end = total
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"field":  field,
+		"total":  total,
+		"values": values[from:end],
+	})
+}
+
+// facetCountsByCount orders facet values most frequent first, then by term
+type facetCountsByCount []facetCount
+
+func (s facetCountsByCount) Len() int      { return len(s) }
+func (s facetCountsByCount) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s facetCountsByCount) Less(i, j int) bool {
+	if s[i].Count != s[j].Count {
+		return s[i].Count > s[j].Count
+	}
+	return s[i].Term < s[j].Term
+}
@@ -0,0 +1,88 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestFacetValuesPaging(t *testing.T) {
+	// brewery-N brews N beers, for 7 breweries
+	docs := make(map[string]interface{})
+	for brewery := 1; brewery <= 7; brewery++ {
+		for beer := 0; beer < brewery; beer++ {
+			docs[fmt.Sprintf("beer-%d-%d", brewery, beer)] = map[string]interface{}{
+				"type":       "beer",
+				"brewery_id": fmt.Sprintf("brewery-%d", brewery),
+			}
+		}
+	}
+	index := newTestIndex(t, docs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("facetValuesTest", index)
+	defer bleveHttp.UnregisterIndexByName("facetValuesTest")
+
+	page := func(from, size int) ([]facetCount, int) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/api/facet_values/brewery_id?from=%d&size=%d", from, size), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := newFacetValuesHandler("facetValuesTest")
+		handler.FieldLookup = func(*http.Request) string { return "brewery_id" }
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var result struct {
+			Total  int          `json:"total"`
+			Values []facetCount `json:"values"`
+		}
+		err = json.Unmarshal(rr.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Values, result.Total
+	}
+
+	seen := make(map[string]bool)
+	var all []facetCount
+	for from := 0; ; from += 3 {
+		values, total := page(from, 3)
+		if total != 7 {
+			t.Fatalf("expected 7 values in total, got %d", total)
+		}
+		if len(values) == 0 {
+			break
+		}
+		for _, value := range values {
+			if seen[value.Term] {
+				t.Errorf("value %s returned on more than one page", value.Term)
+			}
+			seen[value.Term] = true
+		}
+		all = append(all, values...)
+	}
+	if len(all) != 7 {
+		t.Fatalf("expected 7 values across pages, got %d: %v", len(all), all)
+	}
+	for i, value := range all {
+		expect := facetCount{Term: fmt.Sprintf("brewery-%d", 7-i), Count: 7 - i}
+		if value != expect {
+			t.Errorf("expected value %d to be %v, got %v", i, expect, value)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+// feedHandler serves GET /api/feed?q=, an Atom feed of the documents
+// matching q, most recently updated first, with each entry linking to the
+// document at /api/doc/{docID}. Omitting q includes every document.
+type feedHandler struct {
+	defaultIndexName string
+}
+
+func newFeedHandler(defaultIndexName string) *feedHandler {
+	return &feedHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *feedHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	size, err := intParam(req, "size", 20)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+
+	q := req.FormValue("q")
+	var feedQuery query.Query = bleve.NewMatchAllQuery()
+	if q != "" {
+		feedQuery = buildMatchQuery(q, "")
+		fieldUsage.record(feedQuery)
+	}
+	searchRequest := bleve.NewSearchRequestOptions(feedQuery, size, 0, false)
+	searchRequest.SortBy([]string{"-updated", "_id"})
+	searchRequest.Fields = []string{"name", "description", "updated"}
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + req.Host
+	self := base + req.URL.RequestURI()
+
+	feed := atomFeed{
+		Title:   "beer-search: " + q,
+		ID:      self,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "beer-search"},
+		Link:    atomLink{Href: self, Rel: "self"},
+	}
+	for i, hit := range searchResult.Hits {
+		link := base + "/api/doc/" + url.PathEscape(hit.ID)
+		entry := atomEntry{
+			Title:   hit.ID,
+			ID:      link,
+			Updated: feed.Updated,
+			Link:    atomLink{Href: link},
+		}
+		if name, ok := hit.Fields["name"].(string); ok {
+			entry.Title = name
+		}
+		if description, ok := hit.Fields["description"].(string); ok {
+			entry.Summary = description
+		}
+		if updated, ok := hit.Fields["updated"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, updated); err == nil {
+				entry.Updated = t.UTC().Format(time.RFC3339)
+			}
+		}
+		// the feed was last updated when its newest entry was
+		if i == 0 {
+			feed.Updated = entry.Updated
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(feed); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,110 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestFeed(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"old-ale": map[string]interface{}{
+			"type":    "beer",
+			"name":    "Old Ale",
+			"updated": "2010-07-22 20:00:20",
+		},
+		"new-ale": map[string]interface{}{
+			"type":        "beer",
+			"name":        "New Ale",
+			"description": "Fresh off the line",
+			"updated":     "2011-10-04 09:30:00",
+		},
+		"middle-ale": map[string]interface{}{
+			"type":    "beer",
+			"name":    "Middle Ale",
+			"updated": "2011-01-01 00:00:00",
+		},
+		"stout": map[string]interface{}{
+			"type":    "beer",
+			"name":    "Stout",
+			"updated": "2012-01-01 00:00:00",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("feedTest", index)
+	defer bleveHttp.UnregisterIndexByName("feedTest")
+
+	req, err := http.NewRequest("GET", "http://example.com/api/feed?q=ale", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newFeedHandler("feedTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Errorf("expected atom content type, got %s", ct)
+	}
+
+	// decoding checks the feed is well-formed and in the atom namespace
+	var feed atomFeed
+	err = xml.Unmarshal(rr.Body.Bytes(), &feed)
+	if err != nil {
+		t.Fatalf("error parsing feed: %v\n%s", err, rr.Body.String())
+	}
+	if feed.XMLName.Space != "http://www.w3.org/2005/Atom" || feed.XMLName.Local != "feed" {
+		t.Errorf("expected atom feed root element, got %v", feed.XMLName)
+	}
+	if feed.ID == "" || feed.Title == "" || feed.Author.Name == "" {
+		t.Errorf("expected feed id, title and author, got %+v", feed)
+	}
+
+	expectedIDs := []string{"new-ale", "middle-ale", "old-ale"}
+	if len(feed.Entries) != len(expectedIDs) {
+		t.Fatalf("expected %d entries, got %d", len(expectedIDs), len(feed.Entries))
+	}
+	for i, entry := range feed.Entries {
+		expectedLink := "http://example.com/api/doc/" + expectedIDs[i]
+		if entry.Link.Href != expectedLink {
+			t.Errorf("expected entry %d to link to %s, got %s", i, expectedLink, entry.Link.Href)
+		}
+		if entry.ID == "" || entry.Title == "" {
+			t.Errorf("expected entry %d to have an id and title, got %+v", i, entry)
+		}
+		if _, err := time.Parse(time.RFC3339, entry.Updated); err != nil {
+			t.Errorf("expected entry %d updated to be RFC3339, got %s", i, entry.Updated)
+		}
+	}
+	if feed.Updated != feed.Entries[0].Updated {
+		t.Errorf("expected feed updated to match newest entry, got %s", feed.Updated)
+	}
+	if feed.Entries[0].Summary != "Fresh off the line" {
+		t.Errorf("expected summary from description, got %s", feed.Entries[0].Summary)
+	}
+
+	// negative sizes are rejected
+	req, err = http.NewRequest("GET", "/api/feed?q=ale&size=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	newFeedHandler("feedTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a negative size, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,86 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// usageCounter counts the searches targeting each field
+type usageCounter struct {
+	m      sync.Mutex
+	counts map[string]uint64
+}
+
+func newUsageCounter() *usageCounter {
+	return &usageCounter{
+		counts: make(map[string]uint64),
+	}
+}
+
+// fieldUsage counts the fields queried by this process
+var fieldUsage = newUsageCounter()
+
+// record counts one use of each field queried by q, a query without a
+// field counts against _all
+func (c *usageCounter) record(q query.Query) {
+	fields := make(map[string]bool)
+	err := walkQuery(q, func(leaf query.Query) {
+		if fq, ok := leaf.(query.FieldableQuery); ok {
+			field := fq.Field()
+			if field == "" {
+				field = "_all"
+			}
+			fields[field] = true
+		}
+	})
+	if err != nil {
+		// the search reports the error
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	for field := range fields {
+		c.counts[field]++
+	}
+}
+
+func (c *usageCounter) snapshot() map[string]uint64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	rv := make(map[string]uint64, len(c.counts))
+	for field, count := range c.counts {
+		rv[field] = count
+	}
+	return rv
+}
+
+// fieldUsageHandler serves GET /api/field_usage, reporting how many
+// searches since startup queried each field. Counts are per search, a field
+// queried twice in one search counts once, and fields aliased by
+// -fieldAliases count against the field they stand for.
+type fieldUsageHandler struct {
+	counter *usageCounter
+}
+
+func newFieldUsageHandler(counter *usageCounter) *fieldUsageHandler {
+	return &fieldUsageHandler{
+		counter: counter,
+	}
+}
+
+func (h *fieldUsageHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	mustEncode(w, map[string]interface{}{
+		"fields": h.counter.snapshot(),
+	})
+}
@@ -0,0 +1,76 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestFieldUsage(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("fieldUsageTest", index)
+	defer bleveHttp.UnregisterIndexByName("fieldUsageTest")
+	defer func(orig *usageCounter) { fieldUsage = orig }(fieldUsage)
+	fieldUsage = newUsageCounter()
+
+	for _, rawQuery := range []string{
+		"q=stout&field=description",
+		"q=ale&field=description",
+		"q=guinness&field=name",
+		"q=irish",
+	} {
+		if code, _ := serveTestSearch(t, "fieldUsageTest", rawQuery); code != http.StatusOK {
+			t.Fatalf("expected status 200 for %s, got %d", rawQuery, code)
+		}
+	}
+
+	// name counts once although the query string names it twice
+	body := `{"query": {"query": "name:guinness name:smithwicks style:stout"}}`
+	req, err := http.NewRequest("POST", "/api/search", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newSearchRequestHandler("fieldUsageTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, err = http.NewRequest("GET", "/api/field_usage", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	newFieldUsageHandler(fieldUsage).ServeHTTP(rr, req)
+	var result struct {
+		Fields map[string]uint64 `json:"fields"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]uint64{
+		"description": 2,
+		"name":        2,
+		"style":       1,
+		"_all":        1,
+	}
+	if !reflect.DeepEqual(result.Fields, expected) {
+		t.Errorf("expected usage %v, got %v", expected, result.Fields)
+	}
+}
@@ -0,0 +1,252 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter expressions select documents by their field values, for example:
+//
+//	abv > 0 && type == "beer"
+//
+// The supported syntax is:
+//
+//	comparisons  a op b, with op one of == != < <= > >=, where each side is
+//	             a field name, a number or a double quoted string; nested
+//	             fields are named with '.', as in geo.lat
+//	logic        && and || combine comparisons, ! negates, && binds tighter
+//	             than || and parentheses group
+//
+// Numbers compare numerically and strings lexically. A comparison involving
+// a missing field, or between a number and a string, is false, so != is
+// true.
+
+// filterExpr is a parsed filter expression
+type filterExpr interface {
+	match(doc map[string]interface{}) bool
+}
+
+type andFilter struct {
+	left, right filterExpr
+}
+
+func (f andFilter) match(doc map[string]interface{}) bool {
+	return f.left.match(doc) && f.right.match(doc)
+}
+
+type orFilter struct {
+	left, right filterExpr
+}
+
+func (f orFilter) match(doc map[string]interface{}) bool {
+	return f.left.match(doc) || f.right.match(doc)
+}
+
+type notFilter struct {
+	operand filterExpr
+}
+
+func (f notFilter) match(doc map[string]interface{}) bool {
+	return !f.operand.match(doc)
+}
+
+// filterOperand is one side of a comparison, either a field name or a
+// float64 or string literal
+type filterOperand struct {
+	field string
+	value interface{}
+}
+
+func (o filterOperand) resolve(doc map[string]interface{}) interface{} {
+	if o.field == "" {
+		return o.value
+	}
+	var v interface{} = doc
+	for _, part := range strings.Split(o.field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+type compareFilter struct {
+	op          string
+	left, right filterOperand
+}
+
+func (f compareFilter) match(doc map[string]interface{}) bool {
+	var c int
+	switch l := f.left.resolve(doc).(type) {
+	case float64:
+		r, ok := f.right.resolve(doc).(float64)
+		if !ok {
+			return f.op == "!="
+		}
+		if l < r {
+			c = -1
+		} else if l > r {
+			c = 1
+		}
+	case string:
+		r, ok := f.right.resolve(doc).(string)
+		if !ok {
+			return f.op == "!="
+		}
+		c = strings.Compare(l, r)
+	default:
+		return f.op == "!="
+	}
+	switch f.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// parseFilter parses s using the syntax described above
+func parseFilter(s string) (filterExpr, error) {
+	p := &expressionParser{input: s}
+	p.next()
+	f, err := p.parseFilterOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected '%s' at offset %d", p.tok, p.tokPos)
+	}
+	return f, nil
+}
+
+func (p *expressionParser) parseFilterOr() (filterExpr, error) {
+	left, err := p.parseFilterAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "||" {
+		p.next()
+		right, err := p.parseFilterAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseFilterAnd() (filterExpr, error) {
+	left, err := p.parseFilterUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "&&" {
+		p.next()
+		right, err := p.parseFilterUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseFilterUnary() (filterExpr, error) {
+	switch p.tok {
+	case "!":
+		p.next()
+		operand, err := p.parseFilterUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{operand: operand}, nil
+	case "(":
+		p.next()
+		f, err := p.parseFilterOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("expected ')' at offset %d", p.tokPos)
+		}
+		p.next()
+		return f, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *expressionParser) parseComparison() (filterExpr, error) {
+	left, err := p.parseFilterOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.tok
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("expected comparison operator at offset %d", p.tokPos)
+	}
+	p.next()
+	right, err := p.parseFilterOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareFilter{op: op, left: left, right: right}, nil
+}
+
+func (p *expressionParser) parseFilterOperand() (filterOperand, error) {
+	tok := p.tok
+	negative := false
+	if tok == "-" {
+		p.next()
+		tok = p.tok
+		negative = true
+	}
+	switch {
+	case tok == "":
+		return filterOperand{}, fmt.Errorf("unexpected end of expression")
+	case isNumberByte(tok[0]):
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return filterOperand{}, fmt.Errorf("invalid number '%s' at offset %d", tok, p.tokPos)
+		}
+		if negative {
+			f = -f
+		}
+		p.next()
+		return filterOperand{value: f}, nil
+	case negative:
+		return filterOperand{}, fmt.Errorf("expected number at offset %d", p.tokPos)
+	case tok[0] == '"':
+		if len(tok) < 2 || tok[len(tok)-1] != '"' {
+			return filterOperand{}, fmt.Errorf("unterminated string at offset %d", p.tokPos)
+		}
+		p.next()
+		return filterOperand{value: tok[1 : len(tok)-1]}, nil
+	case isIdentByte(tok[0], true):
+		p.next()
+		return filterOperand{field: tok}, nil
+	}
+	return filterOperand{}, fmt.Errorf("unexpected '%s' at offset %d", tok, p.tokPos)
+}
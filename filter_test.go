@@ -0,0 +1,103 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	doc := map[string]interface{}{
+		"type":  "beer",
+		"abv":   5.2,
+		"style": "Oatmeal Stout",
+		"geo": map[string]interface{}{
+			"lat": 53.3,
+		},
+	}
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"abv > 0", true},
+		{"abv >= 5.2 && abv <= 5.2", true},
+		{"abv < 5", false},
+		{"-1 < abv", true},
+		{`type == "beer"`, true},
+		{`type != "beer"`, false},
+		{`style > "Lager"`, true},
+		{`type == "brewery" || abv > 5`, true},
+		{`type == "brewery" || abv > 5 && abv < 5`, false},
+		{`!(type == "brewery")`, true},
+		{"geo.lat > 50", true},
+		{"missing > 0", false},
+		{"missing != 0", true},
+		{`abv == "5.2"`, false},
+	}
+	for _, test := range tests {
+		f, err := parseFilter(test.input)
+		if err != nil {
+			t.Errorf("error parsing '%s': %v", test.input, err)
+			continue
+		}
+		if actual := f.match(doc); actual != test.expected {
+			t.Errorf("expected '%s' to be %t, got %t", test.input, test.expected, actual)
+		}
+	}
+
+	for _, invalid := range []string{"", "abv", "abv >", "abv > 1 &&", `type == "beer`, "(abv > 1", "abv = 1", "abv > - type"} {
+		_, err := parseFilter(invalid)
+		if err == nil {
+			t.Errorf("expected error parsing '%s'", invalid)
+		}
+	}
+}
+
+func TestIndexFilter(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	defer func(orig filterExpr) { indexFilterExpr = orig }(indexFilterExpr)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"light.json":    `{"type":"beer","name":"Light","abv":0}`,
+		"strong.json":   `{"type":"beer","name":"Strong","abv":9.5}`,
+		"session.json":  `{"type":"beer","name":"Session","abv":4.1}`,
+		"nameless.json": `{"type":"beer","name":"Nameless"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	var err error
+	indexFilterExpr, err = parseFilter("abv >= 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err = indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := index.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 documents indexed, got %d", count)
+	}
+	for _, id := range []string{"strong", "session"} {
+		doc, err := index.Document(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc == nil {
+			t.Errorf("expected %s to be indexed", id)
+		}
+	}
+}
@@ -9,7 +9,11 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
@@ -64,3 +68,31 @@ func muxVariableLookup(req *http.Request, name string) string {
 func docIDLookup(req *http.Request) string {
 	return muxVariableLookup(req, "docID")
 }
+
+func showError(w http.ResponseWriter, r *http.Request,
+	msg string, code int) {
+	log.Printf("Reporting error %v/%v", code, msg)
+	http.Error(w, msg, code)
+}
+
+func mustEncode(w io.Writer, i interface{}) {
+	if headered, ok := w.(http.ResponseWriter); ok {
+		headered.Header().Set("Cache-Control", "no-cache")
+		headered.Header().Set("Content-type", "application/json")
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(i); err != nil {
+		panic(err)
+	}
+}
+
+// intParam parses the named form value as an int, returning def when the
+// value is absent
+func intParam(req *http.Request, name string, def int) (int, error) {
+	v := req.FormValue(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,92 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// Document ids are assigned by the -idStrategy in effect while indexing:
+//
+//	filename     the file name without its extension; deterministic and
+//	             stable, reindexing updates documents in place
+//	field        the value of the field named by -idField; deterministic
+//	             and stable as long as the source keeps the field unique,
+//	             documents without it are an error
+//	uuid         a random version 4 UUID; not deterministic, reindexing
+//	             adds a second copy of every document
+//	sequence     1, 2, 3... in ingestion order, restarting with each run;
+//	             deterministic only while the input and its order stay the
+//	             same, an insertion shifts every later id
+//	contentHash  the SHA-1 of the document's bytes; deterministic, but an
+//	             edited document gets a new id, leaving the old one behind,
+//	             and identical documents share an id
+
+// idGenerator assigns ids for one ingestion run
+type idGenerator struct {
+	strategy string
+	field    string
+	seq      uint64
+}
+
+func newIDGenerator(strategy, field string) (*idGenerator, error) {
+	switch strategy {
+	case "filename", "field", "uuid", "sequence", "contentHash":
+	default:
+		return nil, fmt.Errorf("unknown idStrategy '%s'", strategy)
+	}
+	return &idGenerator{
+		strategy: strategy,
+		field:    field,
+	}, nil
+}
+
+// id returns the id of the document parsed from raw into jsonDoc, name is
+// the natural id of its source, such as the file name
+func (g *idGenerator) id(name string, jsonDoc interface{}, raw []byte) (string, error) {
+	switch g.strategy {
+	case "field":
+		doc, _ := jsonDoc.(map[string]interface{})
+		switch v := doc[g.field].(type) {
+		case string:
+			if v != "" {
+				return v, nil
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+		return "", fmt.Errorf("document '%s' has no usable '%s' field for its id", name, g.field)
+	case "uuid":
+		return newUUID()
+	case "sequence":
+		g.seq++
+		return strconv.FormatUint(g.seq, 10), nil
+	case "contentHash":
+		sum := sha1.Sum(raw)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	return name, nil
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
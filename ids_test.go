@@ -0,0 +1,107 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestIDStrategies(t *testing.T) {
+	raw := []byte(`{"id":"guinness","type":"beer"}`)
+	doc := map[string]interface{}{"id": "guinness", "type": "beer", "num": 42.0}
+
+	generate := func(strategy, field string) []string {
+		g, err := newIDGenerator(strategy, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rv []string
+		for i := 0; i < 2; i++ {
+			id, err := g.id("file-name", doc, raw)
+			if err != nil {
+				t.Fatalf("%s: %v", strategy, err)
+			}
+			rv = append(rv, id)
+		}
+		return rv
+	}
+
+	tests := []struct {
+		strategy string
+		field    string
+		expected []string
+	}{
+		{"filename", "", []string{"file-name", "file-name"}},
+		{"field", "id", []string{"guinness", "guinness"}},
+		{"field", "num", []string{"42", "42"}},
+		{"sequence", "", []string{"1", "2"}},
+		// sha1 of raw
+		{"contentHash", "", []string{"164ef3d0d4012e8b2bb3fe3dd90f2c5cf94c67c5", "164ef3d0d4012e8b2bb3fe3dd90f2c5cf94c67c5"}},
+	}
+	for _, test := range tests {
+		actual := generate(test.strategy, test.field)
+		if actual[0] != test.expected[0] || actual[1] != test.expected[1] {
+			t.Errorf("%s: expected %v, got %v", test.strategy, test.expected, actual)
+		}
+	}
+
+	uuids := generate("uuid", "")
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, id := range uuids {
+		if !uuidPattern.MatchString(id) {
+			t.Errorf("expected a version 4 uuid, got %s", id)
+		}
+	}
+	if uuids[0] == uuids[1] {
+		t.Errorf("expected distinct uuids, got %v", uuids)
+	}
+
+	g, err := newIDGenerator("field", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.id("file-name", doc, raw); err == nil {
+		t.Errorf("expected error for a document without the id field")
+	}
+	if _, err := newIDGenerator("bogus", ""); err == nil {
+		t.Errorf("expected error for an unknown strategy")
+	}
+}
+
+func TestIndexBeerIDStrategy(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	defer func(orig string) { *idStrategy = orig }(*idStrategy)
+	defer func(orig string) { *idField = orig }(*idField)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"a.json": `{"type":"beer","name":"Alpha","sku":"beer-100"}`,
+		"b.json": `{"type":"beer","name":"Beta","sku":"beer-200"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	*idStrategy = "field"
+	*idField = "sku"
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err := indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"beer-100", "beer-200"} {
+		doc, err := index.Document(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc == nil {
+			t.Errorf("expected document %s", id)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateWindows are the rolling windows reported by GET /api/index_rate
+var rateWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+}
+
+// rateBuckets is the number of one second buckets kept, enough for the
+// longest window
+const rateBuckets = 15 * 60
+
+// rateCounter counts events in one second buckets so rates can be computed
+// over rolling windows of up to rateBuckets seconds
+type rateCounter struct {
+	m       sync.Mutex
+	now     func() time.Time
+	counts  [rateBuckets]uint64
+	seconds [rateBuckets]int64
+	total   uint64
+}
+
+func newRateCounter(now func() time.Time) *rateCounter {
+	return &rateCounter{
+		now: now,
+	}
+}
+
+// indexRate counts the documents indexed by this process
+var indexRate = newRateCounter(time.Now)
+
+// add records n events at the current time
+func (c *rateCounter) add(n int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	sec := c.now().Unix()
+	i := sec % rateBuckets
+	if c.seconds[i] != sec {
+		c.seconds[i] = sec
+		c.counts[i] = 0
+	}
+	c.counts[i] += uint64(n)
+	c.total += uint64(n)
+}
+
+// rate returns the events per second over the window ending now
+func (c *rateCounter) rate(window time.Duration) float64 {
+	secs := int64(window / time.Second)
+	if secs <= 0 {
+		return 0
+	}
+	if secs > rateBuckets {
+		secs = rateBuckets
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	now := c.now().Unix()
+	var sum uint64
+	for i := range c.counts {
+		if c.seconds[i] > now-secs && c.seconds[i] <= now {
+			sum += c.counts[i]
+		}
+	}
+	return float64(sum) / float64(secs)
+}
+
+func (c *rateCounter) count() uint64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.total
+}
+
+// indexRateHandler serves GET /api/index_rate, reporting the documents
+// indexed per second over each of the rateWindows along with the total
+// indexed since startup
+type indexRateHandler struct {
+	counter *rateCounter
+}
+
+func newIndexRateHandler(counter *rateCounter) *indexRateHandler {
+	return &indexRateHandler{
+		counter: counter,
+	}
+}
+
+func (h *indexRateHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rates := make(map[string]float64, len(rateWindows))
+	for _, window := range rateWindows {
+		rates[window.name] = h.counter.rate(window.duration)
+	}
+	mustEncode(w, map[string]interface{}{
+		"docs_per_second": rates,
+		"total":           h.counter.count(),
+	})
+}
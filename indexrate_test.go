@@ -0,0 +1,80 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIndexRate(t *testing.T) {
+	now := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	counter := newRateCounter(func() time.Time { return now })
+
+	// two minutes of 10 docs/sec, in batches of 5 every half second
+	for i := 0; i < 240; i++ {
+		counter.add(5)
+		now = now.Add(500 * time.Millisecond)
+	}
+
+	req, err := http.NewRequest("GET", "/api/index_rate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newIndexRateHandler(counter).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result struct {
+		Rates map[string]float64 `json:"docs_per_second"`
+		Total uint64             `json:"total"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 1200 {
+		t.Errorf("expected 1200 documents in total, got %d", result.Total)
+	}
+	expected := map[string]float64{
+		"1m":  10,
+		"5m":  1200.0 / 300,
+		"15m": 1200.0 / 900,
+	}
+	for window, rate := range expected {
+		actual := result.Rates[window]
+		if actual < rate*0.9 || actual > rate*1.1 {
+			t.Errorf("expected %s rate near %f, got %f", window, rate, actual)
+		}
+	}
+
+	// after a quiet spell the short window drains first
+	now = now.Add(3 * time.Minute)
+	if rate := counter.rate(time.Minute); rate != 0 {
+		t.Errorf("expected 1m rate 0 after 3 idle minutes, got %f", rate)
+	}
+	if rate := counter.rate(15 * time.Minute); rate < 1.2 || rate > 1.5 {
+		t.Errorf("expected 15m rate near 1.33 after 3 idle minutes, got %f", rate)
+	}
+
+	// buckets are reused once they fall out of the longest window
+	now = now.Add(30 * time.Minute)
+	counter.add(60)
+	if rate := counter.rate(time.Minute); rate != 1 {
+		t.Errorf("expected 1m rate 1 after wrapping, got %f", rate)
+	}
+	if rate := counter.rate(15 * time.Minute); rate != 60.0/900 {
+		t.Errorf("expected stale buckets to be ignored, got %f", rate)
+	}
+}
@@ -0,0 +1,79 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve/analysis/lang/de"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/lang/es"
+	"github.com/blevesearch/bleve/analysis/lang/fr"
+	"github.com/blevesearch/bleve/analysis/lang/it"
+	"github.com/blevesearch/bleve/analysis/lang/nl"
+)
+
+// Bleve picks analyzers per field, not per document, so descriptions are
+// routed by language instead: a document's description is copied into
+// description_<lang>, chosen by its lang field, and each of those fields is
+// mapped with the analyzer for its language. Documents with a missing or
+// unsupported lang use -defaultLanguage. Searching description_<lang>, as
+// the search wrapper's lang parameter does, applies the same analyzer to
+// the query.
+
+const langField = "lang"
+
+// descriptionLanguages maps the supported lang values to their analyzers
+var descriptionLanguages = map[string]string{
+	"de": de.AnalyzerName,
+	"en": en.AnalyzerName,
+	"es": es.AnalyzerName,
+	"fr": fr.AnalyzerName,
+	"it": it.AnalyzerName,
+	"nl": nl.AnalyzerName,
+}
+
+// languageField returns the field holding descriptions in lang
+func languageField(lang string) string {
+	return "description_" + lang
+}
+
+// documentLanguage returns the supported language of jsonDoc's lang field,
+// or -defaultLanguage
+func documentLanguage(doc map[string]interface{}) string {
+	if lang, ok := doc[langField].(string); ok {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if _, ok := descriptionLanguages[lang]; ok {
+			return lang
+		}
+	}
+	return *defaultLanguage
+}
+
+// routeLanguage copies the description of jsonDoc into the field for its
+// language
+func routeLanguage(jsonDoc interface{}) {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if description, ok := doc["description"].(string); ok {
+		doc[languageField(documentLanguage(doc))] = description
+	}
+}
+
+// checkLanguage returns an error unless lang is supported
+func checkLanguage(lang string) error {
+	if _, ok := descriptionLanguages[lang]; !ok {
+		return fmt.Errorf("unsupported language '%s'", lang)
+	}
+	return nil
+}
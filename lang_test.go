@@ -0,0 +1,75 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestLanguageRouting(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"weizen.json":  `{"type":"beer","name":"Weizen","lang":"de","description":"Hefeweizen aus Bayern, naturtrüb gebraut"}`,
+		"pale.json":    `{"type":"beer","name":"Pale","lang":"en","description":"Brewed with flowering hops"}`,
+		"unknown.json": `{"type":"beer","name":"Mystery","lang":"xx","description":"Brewing secrets"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err := indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bleveHttp.RegisterIndexName("langTest", index)
+	defer bleveHttp.UnregisterIndexByName("langTest")
+
+	tests := []struct {
+		rawQuery string
+		expected []string
+	}{
+		// german stemming reduces gebraut and gebrauten alike
+		{"q=gebrauten&lang=de", []string{"weizen"}},
+		// english stemming reduces brewed, brewing and brew alike, the
+		// unknown language falls back to english
+		{"q=brew&lang=en", []string{"pale", "unknown"}},
+		{"q=hop&lang=en", []string{"pale"}},
+		// each language only matches its own documents
+		{"q=bayern&lang=en", nil},
+		{"q=hops&lang=de", nil},
+	}
+	for _, test := range tests {
+		code, result := serveTestSearch(t, "langTest", test.rawQuery)
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200 for %s, got %d", test.rawQuery, code)
+		}
+		ids := make(map[string]bool)
+		for _, hit := range result["hits"].([]interface{}) {
+			ids[hit.(map[string]interface{})["id"].(string)] = true
+		}
+		if len(ids) != len(test.expected) {
+			t.Errorf("%s: expected hits %v, got %v", test.rawQuery, test.expected, ids)
+			continue
+		}
+		for _, id := range test.expected {
+			if !ids[id] {
+				t.Errorf("%s: expected hits %v, got %v", test.rawQuery, test.expected, ids)
+			}
+		}
+	}
+
+	if code, _ := serveTestSearch(t, "langTest", "q=beer&lang=xx"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unsupported language, got %d", code)
+	}
+}
@@ -13,17 +13,22 @@ import (
 	"encoding/json"
 	_ "expvar"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/blevesearch/bleve"
 	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/index/scorch"
 )
 
 var batchSize = flag.Int("batchSize", 100, "batch size for indexing")
@@ -34,6 +39,42 @@ var staticEtag = flag.String("staticEtag", "", "A static etag value.")
 var staticPath = flag.String("static", "static/", "Path to the static content")
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 var memprofile = flag.String("memprofile", "", "write mem profile to file")
+var fuzzyFallbackMinHits = flag.Int("fuzzyFallbackMinHits", 1, "minimum exact hits before a search falls back to fuzzy matching")
+var defaultFuzziness = flag.Int("fuzziness", 1, "default fuzziness for fuzzy matching")
+var defaultFuzzyPrefix = flag.Int("fuzzyPrefix", 0, "default number of leading characters that must match exactly in fuzzy matching")
+var defaultResultWindow = flag.Int("resultWindow", 100, "default number of top hits considered when rescoring or deduplicating")
+var nonScalarPolicy = flag.String("nonScalarPolicy", "join", "handling of non-scalar values in scalar fields: join or skip")
+var preprocessors = flag.String("preprocessors", "", "comma separated list of document preprocessors to run, in order")
+var synonymsPath = flag.String("synonyms", "", "path to a synonyms file applied at index time")
+var createIfMissing = flag.Bool("createIfMissing", true, "create and populate a new index when the index path does not exist")
+var indexType = flag.String("indexType", bleve.Config.DefaultIndexType, "index type used when creating a new index: upside_down or scorch")
+
+// scorch merge policy, used when creating a scorch index. The defaults suit
+// steady-state operation. For a bulk load, raising mergeMaxSegmentsPerTier
+// (to 20 or more) merges less often and reduces write amplification at the
+// cost of searching more segments until merging catches up.
+var mergeMaxSegmentsPerTier = flag.Int("mergeMaxSegmentsPerTier", 10, "scorch: segments allowed per tier before merging")
+var mergeMaxSegmentSize = flag.Int64("mergeMaxSegmentSize", 5000000, "scorch: largest segment, in documents, produced by merging")
+var defaultExactCaseBoost = flag.Float64("exactCaseBoost", 2.0, "boost applied to exact-case name matches")
+var highlightFields = flag.String("highlightFields", "name,description", "comma separated list of fields indexed with term vectors for highlighting")
+var fieldAliases = flag.String("fieldAliases", "", "comma separated list of alias=field pairs rewriting field names in queries")
+var maxClauses = flag.Int("maxClauses", 1024, "maximum number of clauses in a search query, 0 for no limit")
+var indexFilter = flag.String("indexFilter", "", "only index documents matching this filter expression, see filter.go")
+var highlightByDefault = flag.Bool("highlightByDefault", false, "highlight the -highlightFields in searches that do not request highlighting")
+var defaultLanguage = flag.String("defaultLanguage", "en", "language of descriptions in documents with a missing or unsupported lang")
+var storeSource = flag.Bool("storeSource", false, "store the original bytes of each document, served by /api/source")
+var idStrategy = flag.String("idStrategy", "filename", "document id strategy: filename, field, uuid, sequence or contentHash, see ids.go")
+var idField = flag.String("idField", "id", "field holding document ids for -idStrategy field")
+var openTimeout = flag.Duration("openTimeout", 0, "give up opening the index after this long, 0 waits indefinitely")
+var openDegraded = flag.Bool("openDegraded", false, "when opening the index exceeds -openTimeout, serve 503s until it opens instead of exiting")
+var logSampleRate = flag.Int("logSampleRate", 0, "log 1 in this many successful requests, and every error response, 0 disables the access log")
+var minQueryLength = flag.Int("minQueryLength", 0, "minimum length, in characters, of search wrapper queries, 0 for no minimum")
+var shortQueryPolicy = flag.String("shortQueryPolicy", "reject", "handling of queries shorter than -minQueryLength: reject or empty")
+var fieldRenames = flag.String("renameFields", "", "comma separated list of from=to pairs renaming document fields before indexing")
+var coerceNumeric = flag.Bool("coerceNumeric", true, "parse numeric fields given as strings, such as an abv of \"5.5\", see numeric.go")
+var snapshotDir = flag.String("snapshotDir", "", "directory holding index snapshots queried by /api/compare_snapshot")
+var analysisCacheSize = flag.Int("analysisCacheSize", 1024, "number of analyzed texts cached, 0 disables the analysis cache")
+var savedSearchesPath = flag.String("savedSearches", "saved_searches.json", "path to the file holding saved searches")
 
 func main() {
 
@@ -49,69 +90,257 @@ func main() {
 		pprof.StartCPUProfile(f)
 	}
 
-	// open the index
-	beerIndex, err := bleve.Open(*indexPath)
-	if err == bleve.ErrorIndexPathDoesNotExist {
-		log.Printf("Creating new index...")
-		// create a mapping
-		indexMapping, err := buildIndexMapping()
-		if err != nil {
-			log.Fatal(err)
-		}
-		beerIndex, err = bleve.New(*indexPath, indexMapping)
+	err := synonyms.load(*synonymsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fieldAliasMap, err = parseFieldAliases(*fieldAliases)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fieldRenameMap, err = parseFieldRenames(*fieldRenames)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = checkLanguage(*defaultLanguage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *nonScalarPolicy != "join" && *nonScalarPolicy != "skip" {
+		log.Fatalf("unknown nonScalarPolicy '%s'", *nonScalarPolicy)
+	}
+	if *shortQueryPolicy != "reject" && *shortQueryPolicy != "empty" {
+		log.Fatalf("unknown shortQueryPolicy '%s'", *shortQueryPolicy)
+	}
+	err = checkPreprocessors()
+	if err != nil {
+		log.Fatal(err)
+	}
+	analyses = newAnalysisCache(*analysisCacheSize)
+	_, err = newIDGenerator(*idStrategy, *idField)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *indexFilter != "" {
+		indexFilterExpr, err = parseFilter(*indexFilter)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("error parsing indexFilter: %v", err)
 		}
+	}
 
-		// index data in the background
+	savedSearches, err := newSavedSearchStore(*savedSearchesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// open the index, in the background so a slow open cannot stall
+	// startup past -openTimeout
+	opened := openIndexAsync(func() (bleve.Index, bool, error) {
+		return openIndex(*indexPath, *createIfMissing)
+	})
+	result, ok := awaitOpen(opened, *openTimeout)
+	if !ok {
+		if !*openDegraded {
+			log.Fatalf("timed out after %v opening index '%s'", *openTimeout, *indexPath)
+		}
+		log.Printf("timed out after %v opening index '%s', serving 503s until it opens", *openTimeout, *indexPath)
+		atomic.StoreInt32(&indexUnavailable, 1)
 		go func() {
-			err = indexBeer(beerIndex)
-			if err != nil {
-				log.Fatal(err)
-			}
-			pprof.StopCPUProfile()
-			if *memprofile != "" {
-				f, err := os.Create(*memprofile)
-				if err != nil {
-					log.Fatal(err)
-				}
-				pprof.WriteHeapProfile(f)
-				f.Close()
+			result := <-opened
+			if result.err != nil {
+				log.Fatal(result.err)
 			}
+			serveIndex(result.index, result.created)
+			atomic.StoreInt32(&indexUnavailable, 0)
+			log.Printf("index '%s' opened", *indexPath)
 		}()
-	} else if err != nil {
-		log.Fatal(err)
 	} else {
-		log.Printf("Opening existing index...")
+		if result.err != nil {
+			log.Fatal(result.err)
+		}
+		serveIndex(result.index, result.created)
 	}
 
 	// create a router to serve static files
 	router := staticFileRouter()
 
 	// add the API
-	bleveHttp.RegisterIndexName("beer", beerIndex)
-	searchHandler := bleveHttp.NewSearchHandler("beer")
-	router.Handle("/api/search", searchHandler).Methods("POST")
+	router.Handle("/api/search", newSearchRequestHandler("beer")).Methods("POST")
+	router.Handle("/api/search", newSearchQueryHandler("beer")).Methods("GET")
 	listFieldsHandler := bleveHttp.NewListFieldsHandler("beer")
 	router.Handle("/api/fields", listFieldsHandler).Methods("GET")
 
+	router.Handle("/api/compare_search", newCompareSearchHandler("beer")).Methods("POST")
+	router.Handle("/api/compare_snapshot", newCompareSnapshotHandler("beer")).Methods("GET")
+	router.Handle("/api/mapping_preview", newMappingPreviewHandler("beer")).Methods("POST")
+	router.Handle("/api/export", newExportHandler("beer")).Methods("GET")
+	router.Handle("/api/sample", newSampleHandler("beer")).Methods("GET")
+	router.Handle("/api/suggest", newSuggestHandler("beer")).Methods("GET")
+	router.Handle("/api/outliers", newOutliersHandler("beer")).Methods("GET")
+	router.Handle("/api/related_tags", newRelatedTagsHandler("beer")).Methods("GET")
+	facetValuesHandler := newFacetValuesHandler("beer")
+	facetValuesHandler.FieldLookup = func(req *http.Request) string {
+		return muxVariableLookup(req, "field")
+	}
+	router.Handle("/api/facet_values/{field}", facetValuesHandler).Methods("GET")
+
+	docIndexHandler := newDocIndexHandler("beer")
+	docIndexHandler.DocIDLookup = docIDLookup
+	router.Handle("/api/doc/{docID}", docIndexHandler).Methods("PUT")
+	docGetHandler := bleveHttp.NewDocGetHandler("beer")
+	docGetHandler.DocIDLookup = docIDLookup
+	router.Handle("/api/doc/{docID}", docGetHandler).Methods("GET")
+	router.Handle("/api/feed", newFeedHandler("beer")).Methods("GET")
+	brewerySummaryHandler := newBrewerySummaryHandler("beer")
+	brewerySummaryHandler.DocIDLookup = docIDLookup
+	router.Handle("/api/brewery/{docID}/summary", brewerySummaryHandler).Methods("GET")
+	router.Handle("/api/breweries", newBreweriesHandler("beer")).Methods("GET")
+	sourceHandler := newSourceHandler("beer")
+	sourceHandler.DocIDLookup = docIDLookup
+	router.Handle("/api/source/{docID}", sourceHandler).Methods("GET")
+	termVectorsHandler := newTermVectorsHandler("beer")
+	termVectorsHandler.DocIDLookup = docIDLookup
+	router.Handle("/api/termvectors/{docID}", termVectorsHandler).Methods("GET")
+	router.Handle("/api/capabilities", newCapabilitiesHandler()).Methods("GET")
+	router.Handle("/api/index_rate", newIndexRateHandler(indexRate)).Methods("GET")
+	router.Handle("/api/field_usage", newFieldUsageHandler(fieldUsage)).Methods("GET")
+	router.Handle("/api/saved_searches", newSaveSearchHandler(savedSearches)).Methods("POST")
+	router.Handle("/api/saved_searches", newListSavedSearchesHandler(savedSearches)).Methods("GET")
+	runSavedSearchHandler := newRunSavedSearchHandler("beer", savedSearches)
+	runSavedSearchHandler.NameLookup = func(req *http.Request) string {
+		return muxVariableLookup(req, "name")
+	}
+	router.Handle("/api/saved_searches/{name}", runSavedSearchHandler).Methods("GET")
+
+	reloadSynonymsHandler := newReloadSynonymsHandler(func() error {
+		return indexBeer(bleveHttp.IndexByName("beer"))
+	})
+	router.Handle("/api/admin/reload_synonyms", reloadSynonymsHandler).Methods("POST")
+
+	router.Handle("/api/admin/vacuum", newVacuumHandler("beer")).Methods("POST")
+	router.Handle("/api/admin/rebuild_suggest", newRebuildSuggestHandler("beer")).Methods("POST")
+	router.Handle("/api/reindex", newReindexHandler("beer")).Methods("POST")
+	router.Handle("/api/admin/drain", newDrainHandler()).Methods("POST")
+	router.Handle("/api/admin/indexing/pause", newIndexingPauseHandler(indexingPause, true)).Methods("POST")
+	router.Handle("/api/admin/indexing/resume", newIndexingPauseHandler(indexingPause, false)).Methods("POST")
+	router.Handle("/readyz", newReadyzHandler()).Methods("GET")
+
 	debugHandler := bleveHttp.NewDebugDocumentHandler("beer")
 	debugHandler.DocIDLookup = docIDLookup
 	router.Handle("/api/debug/{docID}", debugHandler).Methods("GET")
 
 	// start the HTTP server
-	http.Handle("/", router)
+	var handler http.Handler = newUnavailableHandler(router)
+	if *logSampleRate > 0 {
+		handler = newAccessLogHandler(handler, *logSampleRate)
+	}
+	http.Handle("/", handler)
 	log.Printf("Listening on %v", *bindAddr)
 	log.Fatal(http.ListenAndServe(*bindAddr, nil))
 
 }
 
+// serveIndex registers the opened index with the API, indexing the data
+// into it in the background if it was just created
+func serveIndex(beerIndex bleve.Index, created bool) {
+	bleveHttp.RegisterIndexName("beer", beerIndex)
+	if !created {
+		return
+	}
+	atomic.StoreInt32(&reindexing, 1)
+	go func() {
+		err := indexBeer(beerIndex)
+		atomic.StoreInt32(&reindexing, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pprof.StopCPUProfile()
+		if *memprofile != "" {
+			f, err := os.Create(*memprofile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			pprof.WriteHeapProfile(f)
+			f.Close()
+		}
+	}()
+}
+
+// openIndex opens the index at path. A missing index is created empty when
+// createIfMissing is set and is an error otherwise, so a mistyped -index
+// path cannot silently trigger a full reindex. The bool result reports
+// whether the index was created.
+func openIndex(path string, createIfMissing bool) (bleve.Index, bool, error) {
+	i, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		if !createIfMissing {
+			return nil, false, fmt.Errorf("index '%s' does not exist and -createIfMissing is false", path)
+		}
+		log.Printf("Creating new index...")
+		// create a mapping
+		indexMapping, err := buildIndexMapping(*indexType)
+		if err != nil {
+			return nil, false, err
+		}
+		i, err = bleve.NewUsing(path, indexMapping, *indexType,
+			bleve.Config.DefaultKVStore, indexCreateConfig())
+		if err != nil {
+			return nil, false, err
+		}
+		return i, true, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	log.Printf("Opening existing index...")
+	err = loadSequence(i)
+	if err != nil {
+		i.Close()
+		return nil, false, err
+	}
+	return i, false, nil
+}
+
+// indexCreateConfig returns the index type specific configuration for a
+// new index, persisted by bleve along with the index
+func indexCreateConfig() map[string]interface{} {
+	if *indexType != scorch.Name {
+		return nil
+	}
+	return map[string]interface{}{
+		"scorchMergePlanOptions": map[string]interface{}{
+			"MaxSegmentsPerTier": *mergeMaxSegmentsPerTier,
+			"MaxSegmentSize":     *mergeMaxSegmentSize,
+		},
+	}
+}
+
 func indexBeer(i bleve.Index) error {
+	_, err := indexBeerFrom(i, "", nil)
+	return err
+}
+
+// indexBeerFrom indexes the files of -jsonDir sorting after the file named
+// after, or all of them if after is empty. Before each batch it waits while
+// indexing is paused, then calls stop, if set, and returns early when stop
+// reports true. A paused run also returns once stop reports true. Each
+// batch records the last file it covers under reindexProgressKey, and the
+// final one clears it, so an interrupted run can be resumed from the
+// progress it persisted.
+func indexBeerFrom(i bleve.Index, after string, stop func() bool) (reindexProgress, error) {
+
+	progress := reindexProgress{
+		Last: after,
+	}
+	ids, err := newIDGenerator(*idStrategy, *idField)
+	if err != nil {
+		return progress, err
+	}
 
 	// open the directory
 	dirEntries, err := ioutil.ReadDir(*jsonDir)
 	if err != nil {
-		return err
+		return progress, err
 	}
 
 	// walk the directory entries for indexing
@@ -119,31 +348,66 @@ func indexBeer(i bleve.Index) error {
 	count := 0
 	startTime := time.Now()
 	batch := i.NewBatch()
+	var docs []pendingDoc
 	batchCount := 0
 	for _, dirEntry := range dirEntries {
 		filename := dirEntry.Name()
+		if after != "" && filename <= after {
+			continue
+		}
+		if batchCount == 0 {
+			if !indexingPause.wait(stop) {
+				return progress, nil
+			}
+			if stop != nil && progress.Last != after && stop() {
+				return progress, nil
+			}
+		}
+		progress.Last = filename
 		// read the bytes
 		jsonBytes, err := ioutil.ReadFile(*jsonDir + "/" + filename)
 		if err != nil {
-			return err
+			return progress, err
 		}
 		// parse bytes as json
 		var jsonDoc interface{}
 		err = json.Unmarshal(jsonBytes, &jsonDoc)
 		if err != nil {
-			return err
+			return progress, err
 		}
 		ext := filepath.Ext(filename)
-		docID := filename[:(len(filename) - len(ext))]
-		batch.Index(docID, jsonDoc)
+		docID, err := ids.id(filename[:(len(filename)-len(ext))], jsonDoc, jsonBytes)
+		if err != nil {
+			return progress, err
+		}
+		ok, err := prepareDocument(docID, jsonDoc)
+		if err != nil {
+			return progress, err
+		}
+		if !ok {
+			continue
+		}
+		if *storeSource {
+			contentType := mime.TypeByExtension(ext)
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			storeDocumentSource(jsonDoc, jsonBytes, contentType)
+		}
+		docs = append(docs, pendingDoc{id: docID, doc: jsonDoc})
 		batchCount++
 
 		if batchCount >= *batchSize {
-			err = i.Batch(batch)
+			batch.SetInternal(reindexProgressKey, []byte(filename))
+			err = commitBatch(i, batch, docs, stop)
 			if err != nil {
-				return err
+				return progress, err
 			}
+			bumpIndexVersion()
+			indexRate.add(batchCount)
+			progress.Indexed += batchCount
 			batch = i.NewBatch()
+			docs = nil
 			batchCount = 0
 		}
 		count++
@@ -155,15 +419,89 @@ func indexBeer(i bleve.Index) error {
 		}
 	}
 	// flush the last batch
-	if batchCount > 0 {
-		err = i.Batch(batch)
-		if err != nil {
-			log.Fatal(err)
-		}
+	batch.DeleteInternal(reindexProgressKey)
+	err = commitBatch(i, batch, docs, stop)
+	if err != nil {
+		return progress, err
 	}
+	bumpIndexVersion()
+	indexRate.add(batchCount)
+	progress.Indexed += batchCount
+	progress.Done = true
 	indexDuration := time.Since(startTime)
 	indexDurationSeconds := float64(indexDuration) / float64(time.Second)
 	timePerDoc := float64(indexDuration) / float64(count)
 	log.Printf("Indexed %d documents, in %.2fs (average %.2fms/doc)", count, indexDurationSeconds, timePerDoc/float64(time.Millisecond))
-	return nil
+	return progress, nil
+}
+
+// indexFilterExpr is the parsed -indexFilter, nil when every document is
+// indexed
+var indexFilterExpr filterExpr
+
+// prepareDocument applies the steps shared by every ingestion path to a
+// parsed document before it is indexed. It returns false when the document
+// should not be indexed. Sequence numbers are only stamped when the
+// document is committed, see indexSequenced.
+func prepareDocument(docID string, jsonDoc interface{}) (bool, error) {
+	renameFields(jsonDoc)
+	if *coerceNumeric {
+		coerceNumericFields(docID, jsonDoc)
+	}
+	if indexFilterExpr != nil {
+		doc, _ := jsonDoc.(map[string]interface{})
+		if !indexFilterExpr.match(doc) {
+			return false, nil
+		}
+	}
+	if !normalizeScalarFields(docID, jsonDoc) {
+		return false, nil
+	}
+	err := preprocessDocument(docID, jsonDoc)
+	if err != nil {
+		return false, err
+	}
+	routeLanguage(jsonDoc)
+	deriveBrewery(jsonDoc)
+	recordFieldLengths(jsonDoc)
+	synonyms.expand(jsonDoc)
+	return true, nil
+}
+
+// scalarFields are mapped as single values, a document holding an array or
+// object in one of them is handled according to -nonScalarPolicy
+var scalarFields = []string{"name", "type", "style", "category"}
+
+// normalizeScalarFields applies -nonScalarPolicy to the scalar fields of
+// jsonDoc. With "join" array values are joined with spaces and object values
+// are dropped, with "skip" the whole document is skipped. It returns false
+// when the document should not be indexed.
+func normalizeScalarFields(docID string, jsonDoc interface{}) bool {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok {
+		return true
+	}
+	for _, field := range scalarFields {
+		switch value := doc[field].(type) {
+		case []interface{}:
+			if *nonScalarPolicy == "skip" {
+				log.Printf("skipping %s: field %s is an array", docID, field)
+				return false
+			}
+			parts := make([]string, len(value))
+			for i, v := range value {
+				parts[i] = fmt.Sprint(v)
+			}
+			doc[field] = strings.Join(parts, " ")
+			log.Printf("joined array field %s of %s", field, docID)
+		case map[string]interface{}:
+			if *nonScalarPolicy == "skip" {
+				log.Printf("skipping %s: field %s is an object", docID, field)
+				return false
+			}
+			delete(doc, field)
+			log.Printf("dropped object field %s of %s", field, docID)
+		}
+	}
+	return true
 }
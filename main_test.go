@@ -23,7 +23,7 @@ import (
 func TestBeerSearchAll(t *testing.T) {
 	defer os.RemoveAll("beer-search-test.bleve")
 
-	mapping, err := buildIndexMapping()
+	mapping, err := buildIndexMapping(bleve.Config.DefaultIndexType)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -210,7 +210,7 @@ type jsonFile struct {
 func TestBeerSearchBug87(t *testing.T) {
 	defer os.RemoveAll("beer-search-test.bleve")
 
-	mapping, err := buildIndexMapping()
+	mapping, err := buildIndexMapping(bleve.Config.DefaultIndexType)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -257,3 +257,222 @@ func TestBeerSearchBug87(t *testing.T) {
 		}
 	}
 }
+
+// newTestIndex creates an in-memory index using the application mapping
+// and indexes the provided documents
+func newTestIndex(t testing.TB, docs map[string]interface{}) bleve.Index {
+	mapping, err := buildIndexMapping(bleve.Config.DefaultIndexType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := bleve.NewMemOnly(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := index.NewBatch()
+	for docID, doc := range docs {
+		err = batch.Index(docID, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = index.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestHighlightFields(t *testing.T) {
+	defer func(orig string) { *highlightFields = orig }(*highlightFields)
+	*highlightFields = "name"
+
+	index := newTestIndex(t, map[string]interface{}{
+		"hoppy": map[string]interface{}{
+			"type":        "beer",
+			"name":        "Hoppy Ale",
+			"description": "A hoppy and bitter ale",
+		},
+	})
+	defer index.Close()
+
+	searchRequest := bleve.NewSearchRequest(bleve.NewMatchQuery("hoppy"))
+	searchRequest.Highlight = bleve.NewHighlight()
+	searchRequest.Fields = []string{"description", "type"}
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searchResult.Hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(searchResult.Hits))
+	}
+	fragments := searchResult.Hits[0].Fragments
+	if len(fragments["name"]) == 0 {
+		t.Errorf("expected fragments for highlighted field name, got %v", fragments)
+	}
+	if len(fragments["description"]) != 0 {
+		t.Errorf("expected no fragments for description, got %v", fragments["description"])
+	}
+	// fields are stored whether or not they are highlighted
+	fields := searchResult.Hits[0].Fields
+	if fields["description"] != "A hoppy and bitter ale" || fields["type"] != "beer" {
+		t.Errorf("expected stored description and type, got %v", fields)
+	}
+}
+
+// writeTestJSONDir writes each document to its own file in a new temporary
+// directory, for use as -jsonDir
+func writeTestJSONDir(t *testing.T, docs map[string]string) string {
+	dir, err := ioutil.TempDir("", "beer-search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for filename, contents := range docs {
+		err = ioutil.WriteFile(filepath.Join(dir, filename), []byte(contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestIndexBeerArrayName(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	defer func(orig string) { *nonScalarPolicy = orig }(*nonScalarPolicy)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"array.json":  `{"type":"beer","name":["Hoppy","Ale"]}`,
+		"scalar.json": `{"type":"beer","name":"Malty Ale"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	for _, policy := range []string{"join", "skip"} {
+		*nonScalarPolicy = policy
+		index := newTestIndex(t, nil)
+		err := indexBeer(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		phraseQuery := bleve.NewMatchPhraseQuery("hoppy ale")
+		phraseQuery.SetField("name")
+		searchResult, err := index.Search(bleve.NewSearchRequest(phraseQuery))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedHits := uint64(1)
+		if policy == "skip" {
+			expectedHits = 0
+		}
+		if searchResult.Total != expectedHits {
+			t.Errorf("policy %s: expected %d hits, got %d", policy, expectedHits, searchResult.Total)
+		}
+
+		count, err := index.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expectedHits+1 {
+			t.Errorf("policy %s: expected %d documents, got %d", policy, expectedHits+1, count)
+		}
+		index.Close()
+	}
+}
+
+func TestOpenIndexCreateIfMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beer-search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "missing.bleve")
+
+	// strict mode refuses to create the index
+	index, created, err := openIndex(path, false)
+	if err == nil {
+		index.Close()
+		t.Fatalf("expected error opening missing index in strict mode")
+	}
+	if created {
+		t.Errorf("expected no index to be created in strict mode")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to still not exist, got %v", path, err)
+	}
+
+	// the default creates it
+	index, created, err = openIndex(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Errorf("expected index to be created")
+	}
+	index.Close()
+
+	// once it exists strict mode opens it
+	index, created, err = openIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Errorf("expected existing index to be opened, not created")
+	}
+	index.Close()
+}
+
+func TestOpenIndexMergePolicy(t *testing.T) {
+	defer func(orig string) { *indexType = orig }(*indexType)
+	defer func(orig int) { *mergeMaxSegmentsPerTier = orig }(*mergeMaxSegmentsPerTier)
+	defer func(orig int64) { *mergeMaxSegmentSize = orig }(*mergeMaxSegmentSize)
+	*indexType = "scorch"
+	*mergeMaxSegmentsPerTier = 25
+	*mergeMaxSegmentSize = 123456
+
+	dir, err := ioutil.TempDir("", "beer-search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "scorch.bleve")
+
+	index, _, err := openIndex(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+
+	// bleve persists the creation config alongside the index
+	metaBytes, err := ioutil.ReadFile(filepath.Join(path, "index_meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta struct {
+		IndexType string `json:"index_type"`
+		Config    struct {
+			MergePlanOptions struct {
+				MaxSegmentsPerTier int
+				MaxSegmentSize     int64
+			} `json:"scorchMergePlanOptions"`
+		} `json:"config"`
+	}
+	err = json.Unmarshal(metaBytes, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.IndexType != "scorch" {
+		t.Errorf("expected scorch index, got %s", meta.IndexType)
+	}
+	if meta.Config.MergePlanOptions.MaxSegmentsPerTier != 25 {
+		t.Errorf("expected 25 segments per tier, got %d", meta.Config.MergePlanOptions.MaxSegmentsPerTier)
+	}
+	if meta.Config.MergePlanOptions.MaxSegmentSize != 123456 {
+		t.Errorf("expected max segment size 123456, got %d", meta.Config.MergePlanOptions.MaxSegmentSize)
+	}
+
+	// and the options are accepted when the index is reopened
+	index, _, err = openIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+}
@@ -14,44 +14,151 @@ package main
 
 import (
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
 	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
 	"github.com/blevesearch/bleve/mapping"
 )
 
-func buildIndexMapping() (mapping.IndexMapping, error) {
+// buildIndexMapping returns the mapping of a new index of the given type,
+// such as scorch or upside_down
+func buildIndexMapping(indexType string) (mapping.IndexMapping, error) {
 
-	// a generic reusable mapping for english text
-	englishTextFieldMapping := bleve.NewTextFieldMapping()
-	englishTextFieldMapping.Analyzer = en.AnalyzerName
-
-	// a generic reusable mapping for keyword text
-	keywordFieldMapping := bleve.NewTextFieldMapping()
-	keywordFieldMapping.Analyzer = keyword.Name
+	highlighted := highlightFieldSet()
 
 	beerMapping := bleve.NewDocumentMapping()
 
-	// name
-	beerMapping.AddFieldMappingsAt("name", englishTextFieldMapping)
+	// name, plus a case preserving copy for boosting exact-case matches
+	exactCaseNameFieldMapping := bleve.NewTextFieldMapping()
+	exactCaseNameFieldMapping.Name = exactCaseNameField
+	exactCaseNameFieldMapping.Analyzer = exactCaseAnalyzer
+	exactCaseNameFieldMapping.Store = false
+	exactCaseNameFieldMapping.IncludeTermVectors = false
+	exactCaseNameFieldMapping.IncludeInAll = false
+	beerMapping.AddFieldMappingsAt("name",
+		newTextFieldMapping(en.AnalyzerName, "name", highlighted),
+		exactCaseNameFieldMapping)
 
 	// description
 	beerMapping.AddFieldMappingsAt("description",
-		englishTextFieldMapping)
+		newTextFieldMapping(en.AnalyzerName, "description", highlighted))
+
+	beerMapping.AddFieldMappingsAt("type",
+		newTextFieldMapping(keyword.Name, "type", highlighted))
+	beerMapping.AddFieldMappingsAt("style",
+		newTextFieldMapping(keyword.Name, "style", highlighted))
+	beerMapping.AddFieldMappingsAt("category",
+		newTextFieldMapping(keyword.Name, "category", highlighted))
+	beerMapping.AddFieldMappingsAt("tags",
+		newTextFieldMapping(keyword.Name, "tags", highlighted))
+	beerMapping.AddFieldMappingsAt("abv_category",
+		newTextFieldMapping(keyword.Name, "abv_category", highlighted))
+
+	beerMapping.AddFieldMappingsAt(breweryIDField,
+		newTextFieldMapping(keyword.Name, breweryIDField, highlighted))
+
+	for _, field := range numericFields {
+		beerMapping.AddFieldMappingsAt(field, bleve.NewNumericFieldMapping())
+	}
+
+	// brewery name derived from brewery_id, see crossfields.go
+	beerMapping.AddFieldMappingsAt(breweryField,
+		newTextFieldMapping(en.AnalyzerName, breweryField, highlighted))
 
-	beerMapping.AddFieldMappingsAt("type", keywordFieldMapping)
-	beerMapping.AddFieldMappingsAt("style", keywordFieldMapping)
-	beerMapping.AddFieldMappingsAt("category", keywordFieldMapping)
+	beerMapping.AddFieldMappingsAt(synonymsField,
+		newTextFieldMapping(en.AnalyzerName, synonymsField, highlighted))
 
 	breweryMapping := bleve.NewDocumentMapping()
-	breweryMapping.AddFieldMappingsAt("name", englishTextFieldMapping)
-	breweryMapping.AddFieldMappingsAt("description", englishTextFieldMapping)
+	breweryMapping.AddFieldMappingsAt("name",
+		newTextFieldMapping(en.AnalyzerName, "name", highlighted))
+	breweryMapping.AddFieldMappingsAt("description",
+		newTextFieldMapping(en.AnalyzerName, "description", highlighted))
+	breweryMapping.AddFieldMappingsAt(synonymsField,
+		newTextFieldMapping(en.AnalyzerName, synonymsField, highlighted))
+
+	// descriptions routed by language, see lang.go
+	addLanguageFieldMappings(beerMapping, highlighted)
+	addLanguageFieldMappings(breweryMapping, highlighted)
+
+	// the export sequence number is only ever queried by range
+	seqFieldMapping := bleve.NewNumericFieldMapping()
+	seqFieldMapping.IncludeInAll = false
+	beerMapping.AddFieldMappingsAt(seqField, seqFieldMapping)
+	breweryMapping.AddFieldMappingsAt(seqField, seqFieldMapping)
+
+	// field lengths, see outliers.go
+	for _, field := range lengthFields {
+		lengthFieldMapping := bleve.NewNumericFieldMapping()
+		lengthFieldMapping.IncludeInAll = false
+		beerMapping.AddFieldMappingsAt(lengthField(field), lengthFieldMapping)
+		breweryMapping.AddFieldMappingsAt(lengthField(field), lengthFieldMapping)
+	}
 
 	indexMapping := bleve.NewIndexMapping()
+	addSourceFieldMappings(beerMapping)
+	addSourceFieldMappings(breweryMapping)
+	addSourceFieldMappings(indexMapping.DefaultMapping)
 	indexMapping.AddDocumentMapping("beer", beerMapping)
 	indexMapping.AddDocumentMapping("brewery", breweryMapping)
 
 	indexMapping.TypeField = "type"
 	indexMapping.DefaultAnalyzer = "en"
 
+	err := indexMapping.AddCustomAnalyzer(exactCaseAnalyzer,
+		map[string]interface{}{
+			"type":      custom.Name,
+			"tokenizer": unicode.Name,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	tailorIndexMapping(indexMapping, indexType)
 	return indexMapping, nil
 }
+
+// newTextFieldMapping returns a stored text field mapping using the named
+// analyzer. Highlighting also needs term vectors, so only fields listed in
+// -highlightFields pay for them.
+func newTextFieldMapping(analyzer, path string, highlighted map[string]bool) *mapping.FieldMapping {
+	fieldMapping := bleve.NewTextFieldMapping()
+	fieldMapping.Analyzer = analyzer
+	fieldMapping.Store = true
+	fieldMapping.IncludeTermVectors = highlighted[path]
+	return fieldMapping
+}
+
+// addLanguageFieldMappings maps the description field of each supported
+// language with that language's analyzer. The description field itself is
+// already part of _all, so these are left out of it.
+func addLanguageFieldMappings(documentMapping *mapping.DocumentMapping, highlighted map[string]bool) {
+	for lang, analyzer := range descriptionLanguages {
+		field := languageField(lang)
+		fieldMapping := newTextFieldMapping(analyzer, field, highlighted)
+		fieldMapping.IncludeInAll = false
+		documentMapping.AddFieldMappingsAt(field, fieldMapping)
+	}
+}
+
+// addSourceFieldMappings stores the original document bytes kept by
+// -storeSource without indexing them
+func addSourceFieldMappings(documentMapping *mapping.DocumentMapping) {
+	for _, field := range []string{sourceField, sourceTypeField} {
+		fieldMapping := bleve.NewTextFieldMapping()
+		fieldMapping.Index = false
+		fieldMapping.IncludeInAll = false
+		fieldMapping.IncludeTermVectors = false
+		fieldMapping.DocValues = false
+		documentMapping.AddFieldMappingsAt(field, fieldMapping)
+	}
+}
+
+// highlightFieldSet parses the -highlightFields flag
+func highlightFieldSet() map[string]bool {
+	rv := make(map[string]bool)
+	for _, field := range highlightFieldList() {
+		rv[field] = true
+	}
+	return rv
+}
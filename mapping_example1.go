@@ -26,7 +26,7 @@ import (
 
 const textFieldAnalyzer = "en"
 
-func buildIndexMapping() (mapping.IndexMapping, error) {
+func buildIndexMapping(indexType string) (mapping.IndexMapping, error) {
 
 	// a custom field definition that uses our custom analyzer
 	notTooLongFieldMapping := bleve.NewTextFieldMapping()
@@ -99,5 +99,6 @@ func buildIndexMapping() (mapping.IndexMapping, error) {
 		return nil, err
 	}
 
+	tailorIndexMapping(indexMapping, indexType)
 	return indexMapping, nil
 }
@@ -25,7 +25,7 @@ import (
 
 const textFieldAnalyzer = "en"
 
-func buildIndexMapping() (mapping.IndexMapping, error) {
+func buildIndexMapping(indexType string) (mapping.IndexMapping, error) {
 
 	// a custom field definition that uses our custom analyzer
 	edgeNgram325FieldMapping := bleve.NewTextFieldMapping()
@@ -98,5 +98,6 @@ func buildIndexMapping() (mapping.IndexMapping, error) {
 		return nil, err
 	}
 
+	tailorIndexMapping(indexMapping, indexType)
 	return indexMapping, nil
 }
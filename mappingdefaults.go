@@ -0,0 +1,44 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/index/scorch"
+	"github.com/blevesearch/bleve/mapping"
+)
+
+// tailorIndexMapping adjusts the defaults of an index mapping to the index
+// type it is created with. Only scorch reads doc values, which it sorts and
+// facets with, so they are kept for keyword and non-text fields there, but
+// not for analyzed text, whose terms make meaningless sort keys and facets.
+// upside_down sorts and facets from its back index instead, so its mappings
+// leave doc values out.
+func tailorIndexMapping(m *mapping.IndexMappingImpl, indexType string) {
+	docValues := indexType == scorch.Name
+	m.DocValuesDynamic = docValues
+	tailorDocumentMapping(m.DefaultMapping, docValues)
+	for _, documentMapping := range m.TypeMapping {
+		tailorDocumentMapping(documentMapping, docValues)
+	}
+}
+
+func tailorDocumentMapping(documentMapping *mapping.DocumentMapping, docValues bool) {
+	if documentMapping == nil {
+		return
+	}
+	for _, fieldMapping := range documentMapping.Fields {
+		analyzedText := fieldMapping.Type == "text" && fieldMapping.Analyzer != keyword.Name
+		fieldMapping.DocValues = docValues && fieldMapping.Index && !analyzedText
+	}
+	for _, property := range documentMapping.Properties {
+		tailorDocumentMapping(property, docValues)
+	}
+}
@@ -0,0 +1,129 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index/scorch"
+	"github.com/blevesearch/bleve/index/upsidedown"
+	"github.com/blevesearch/bleve/mapping"
+)
+
+// beerFieldDocValues returns whether each field mapped at path in the beer
+// mapping keeps doc values
+func beerFieldDocValues(t *testing.T, m mapping.IndexMapping, path string) []bool {
+	documentMapping := m.(*mapping.IndexMappingImpl).TypeMapping["beer"].Properties[path]
+	if documentMapping == nil {
+		t.Fatalf("no mapping for '%s'", path)
+	}
+	var rv []bool
+	for _, fieldMapping := range documentMapping.Fields {
+		rv = append(rv, fieldMapping.DocValues)
+	}
+	return rv
+}
+
+func TestBuildIndexMappingPerIndexType(t *testing.T) {
+	scorchMapping, err := buildIndexMapping(scorch.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upsideDownMapping, err := buildIndexMapping(upsidedown.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scorch keeps doc values for keywords and numbers only
+	for _, path := range []string{"style", "type", breweryIDField, "abv"} {
+		for _, docValues := range beerFieldDocValues(t, scorchMapping, path) {
+			if !docValues {
+				t.Errorf("scorch: expected doc values for '%s'", path)
+			}
+		}
+	}
+	for _, path := range []string{"name", "description", breweryField} {
+		for _, docValues := range beerFieldDocValues(t, scorchMapping, path) {
+			if docValues {
+				t.Errorf("scorch: expected no doc values for analyzed '%s'", path)
+			}
+		}
+	}
+	if !scorchMapping.(*mapping.IndexMappingImpl).DocValuesDynamic {
+		t.Error("scorch: expected doc values for dynamic fields")
+	}
+
+	// upside_down never reads them
+	for _, path := range []string{"style", "abv", "name", "description"} {
+		for _, docValues := range beerFieldDocValues(t, upsideDownMapping, path) {
+			if docValues {
+				t.Errorf("upside_down: expected no doc values for '%s'", path)
+			}
+		}
+	}
+	if upsideDownMapping.(*mapping.IndexMappingImpl).DocValuesDynamic {
+		t.Error("upside_down: expected no doc values for dynamic fields")
+	}
+
+	// both still sort and facet by keywords
+	for _, indexType := range []string{scorch.Name, upsidedown.Name} {
+		dir, err := ioutil.TempDir("", "beer-search-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		m, err := buildIndexMapping(indexType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, err := bleve.NewUsing(filepath.Join(dir, "mapping.bleve"), m, indexType, bleve.Config.DefaultKVStore, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer index.Close()
+		docs := map[string]interface{}{
+			"guinness": map[string]interface{}{
+				"type":       "beer",
+				"name":       "Guinness Draught",
+				"style":      "Irish Dry Stout",
+				"brewery_id": "guinness",
+			},
+			"smithwicks": map[string]interface{}{
+				"type":       "beer",
+				"name":       "Smithwick's",
+				"style":      "Irish Red Ale",
+				"brewery_id": "smithwicks",
+			},
+		}
+		for id, doc := range docs {
+			err = index.Index(id, doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		searchRequest := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+		searchRequest.SortBy([]string{"-" + breweryIDField})
+		searchRequest.AddFacet("styles", bleve.NewFacetRequest("style", 10))
+		searchResult, err := index.Search(searchRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(searchResult.Hits) != 2 || searchResult.Hits[0].ID != "smithwicks" {
+			t.Errorf("%s: expected smithwicks sorted first, got %v", indexType, searchResult.Hits)
+		}
+		if styles := searchResult.Facets["styles"]; styles == nil || len(styles.Terms) != 2 {
+			t.Errorf("%s: expected 2 styles, got %v", indexType, styles)
+		}
+	}
+}
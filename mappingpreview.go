@@ -0,0 +1,209 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/document"
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/mapping"
+)
+
+type mappingPreviewRequest struct {
+	Mapping  *mapping.IndexMappingImpl `json:"mapping"`
+	ID       string                    `json:"id"`
+	Document interface{}               `json:"document"`
+}
+
+// previewedField describes how a single value of a document is indexed
+type previewedField struct {
+	Name           string           `json:"name"`
+	ArrayPositions []uint64         `json:"array_positions,omitempty"`
+	Kind           string           `json:"kind"`
+	Indexed        bool             `json:"indexed"`
+	Stored         bool             `json:"stored"`
+	TermVectors    bool             `json:"term_vectors"`
+	DocValues      bool             `json:"doc_values"`
+	Value          interface{}      `json:"value,omitempty"`
+	Tokens         []previewedToken `json:"tokens,omitempty"`
+}
+
+type previewedToken struct {
+	Term     string `json:"term"`
+	Position int    `json:"position"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// mappingPreviewHandler serves POST /api/mapping_preview, showing how a
+// sample document would be indexed under a candidate mapping, alongside how
+// the live index maps it, so the effect of a mapping change can be checked
+// before reindexing:
+//
+//	{"mapping": {...}, "id": "sample", "document": {...}}
+//
+// The mapping takes the form bleve serializes index mappings in. Nothing is
+// written to the index.
+type mappingPreviewHandler struct {
+	defaultIndexName string
+}
+
+func newMappingPreviewHandler(defaultIndexName string) *mappingPreviewHandler {
+	return &mappingPreviewHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *mappingPreviewHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading request body: %v", err), 400)
+		return
+	}
+	var previewRequest mappingPreviewRequest
+	err = json.Unmarshal(requestBody, &previewRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing request: %v", err), 400)
+		return
+	}
+	if previewRequest.Mapping == nil {
+		showError(w, req, "mapping cannot be empty", 400)
+		return
+	}
+	if previewRequest.Document == nil {
+		showError(w, req, "document cannot be empty", 400)
+		return
+	}
+	err = previewRequest.Mapping.Validate()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("invalid mapping: %v", err), 400)
+		return
+	}
+
+	candidate, err := previewMapping(previewRequest.Mapping, previewRequest.ID, previewRequest.Document, nil)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error mapping document: %v", err), 400)
+		return
+	}
+	current, err := previewMapping(index.Mapping(), previewRequest.ID, previewRequest.Document, analyses)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error mapping document with the live mapping: %v", err), 500)
+		return
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"candidate": candidate,
+		"current":   current,
+	})
+}
+
+// previewMapping maps jsonDoc with m, returning each indexed value in the
+// order the mapping produced them. Text values list the tokens their
+// analyzer emits, other values the value indexed. Text is analyzed through
+// cache, when given.
+func previewMapping(m mapping.IndexMapping, id string, jsonDoc interface{}, cache *analysisCache) ([]previewedField, error) {
+	// mapping may modify the document, so work on a copy
+	data, err := json.Marshal(jsonDoc)
+	if err != nil {
+		return nil, err
+	}
+	var docCopy interface{}
+	err = json.Unmarshal(data, &docCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := document.NewDocument(id)
+	err = m.MapDocument(doc, docCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]previewedField, 0, len(doc.Fields))
+	for _, field := range doc.Fields {
+		options := field.Options()
+		previewed := previewedField{
+			Name:           field.Name(),
+			ArrayPositions: field.ArrayPositions(),
+			Indexed:        options.IsIndexed(),
+			Stored:         options.IsStored(),
+			TermVectors:    options.IncludeTermVectors(),
+			DocValues:      options.IncludeDocValues(),
+		}
+		switch field := field.(type) {
+		case *document.TextField:
+			previewed.Kind = "text"
+			previewed.Tokens = previewTokens(m, field, cache)
+		case *document.NumericField:
+			previewed.Kind = "numeric"
+			previewed.Value, _ = field.Number()
+		case *document.DateTimeField:
+			previewed.Kind = "datetime"
+			previewed.Value, _ = field.DateTime()
+		case *document.BooleanField:
+			previewed.Kind = "boolean"
+			previewed.Value, _ = field.Boolean()
+		case *document.GeoPointField:
+			previewed.Kind = "geopoint"
+			lon, _ := field.Lon()
+			lat, _ := field.Lat()
+			previewed.Value = []float64{lon, lat}
+		default:
+			previewed.Kind = "unknown"
+		}
+		rv = append(rv, previewed)
+	}
+	return rv, nil
+}
+
+// previewTokens analyzes field as indexing would, a field without an
+// analyzer is indexed as a single token
+func previewTokens(m mapping.IndexMapping, field *document.TextField, cache *analysisCache) []previewedToken {
+	value := field.Value()
+	analyzer := field.Analyzer()
+	if analyzer == nil {
+		return []previewedToken{{
+			Term:     string(value),
+			Position: 1,
+			End:      len(value),
+		}}
+	}
+	var tokens analysis.TokenStream
+	// only fields analyzed by the analyzer their path names can be cached
+	if name := m.AnalyzerNameForPath(field.Name()); cache != nil && name != "" && m.AnalyzerNamed(name) == analyzer {
+		tokens, _ = cache.analyze(m, name, string(value))
+	} else {
+		// token filters may rewrite terms in place
+		value = append([]byte(nil), value...)
+		tokens = analyzer.Analyze(value)
+	}
+	rv := make([]previewedToken, len(tokens))
+	for i, token := range tokens {
+		rv[i] = previewedToken{
+			Term:     string(token.Term),
+			Position: token.Position,
+			Start:    token.Start,
+			End:      token.End,
+		}
+	}
+	return rv
+}
@@ -0,0 +1,100 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestMappingPreview(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("mappingPreviewTest", index)
+	defer bleveHttp.UnregisterIndexByName("mappingPreviewTest")
+
+	// the live mapping indexes style as a keyword, the candidate as text
+	styleMapping := bleve.NewTextFieldMapping()
+	styleMapping.Analyzer = en.AnalyzerName
+	beerMapping := bleve.NewDocumentMapping()
+	beerMapping.AddFieldMappingsAt("style", styleMapping)
+	candidate := bleve.NewIndexMapping()
+	candidate.TypeField = "type"
+	candidate.AddDocumentMapping("beer", beerMapping)
+	candidateJSON, err := json.Marshal(candidate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/api/mapping_preview", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newMappingPreviewHandler("mappingPreviewTest").ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(`{"mapping": ` + string(candidateJSON) + `, "id": "sample",
+		"document": {"type": "beer", "style": "American-Style India Pale Ales"}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result map[string][]struct {
+		Name   string `json:"name"`
+		Kind   string `json:"kind"`
+		Tokens []struct {
+			Term string `json:"term"`
+		} `json:"tokens"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	styleTerms := func(version string) []string {
+		for _, field := range result[version] {
+			if field.Name == "style" {
+				terms := []string{}
+				for _, token := range field.Tokens {
+					terms = append(terms, token.Term)
+				}
+				return terms
+			}
+		}
+		t.Fatalf("no style field in the %s preview: %s", version, rr.Body.String())
+		return nil
+	}
+	if terms := styleTerms("current"); !reflect.DeepEqual(terms, []string{"American-Style India Pale Ales"}) {
+		t.Errorf("expected style kept whole by the live mapping, got %v", terms)
+	}
+	expect := []string{"american", "style", "india", "pale", "al"}
+	if terms := styleTerms("candidate"); !reflect.DeepEqual(terms, expect) {
+		t.Errorf("expected style analyzed to %v by the candidate, got %v", expect, terms)
+	}
+
+	for _, body := range []string{
+		`{"document": {"type": "beer"}}`,
+		`{"mapping": ` + string(candidateJSON) + `}`,
+		`{"mapping": {"default_analyzer": "nope"}, "document": {"type": "beer"}}`,
+	} {
+		if rr := serve(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s, got %d", body, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// numericFields are mapped as numbers. Bleve skips a string value in a
+// numeric field without complaint, so values given as strings, such as an
+// abv of "5.5", are parsed before indexing unless -coerceNumeric is false.
+var numericFields = []string{"abv", "ibu", "srm"}
+
+// coerceNumericFields parses string values of the numeric fields of jsonDoc
+// into numbers. Values that do not parse are logged and dropped, as they
+// could not be indexed anyway.
+func coerceNumericFields(docID string, jsonDoc interface{}) {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range numericFields {
+		s, ok := doc[field].(string)
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			log.Printf("dropping %s '%s' of %s, not a number", field, s, docID)
+			delete(doc, field)
+			continue
+		}
+		doc[field] = f
+	}
+}
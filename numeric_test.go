@@ -0,0 +1,75 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestIndexBeerNumericStrings(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"lager.json":  `{"type":"beer","name":"Lager","abv":"4.8"}`,
+		"stout.json":  `{"type":"beer","name":"Stout","abv":" 7.5 "}`,
+		"porter.json": `{"type":"beer","name":"Porter","abv":5.6}`,
+		"broken.json": `{"type":"beer","name":"Broken","abv":"strong"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err := indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// string and numeric values range and sort alike
+	min := 5.0
+	abvQuery := bleve.NewNumericRangeQuery(&min, nil)
+	abvQuery.SetField("abv")
+	searchRequest := bleve.NewSearchRequest(abvQuery)
+	searchRequest.SortBy([]string{"-abv"})
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, hit := range searchResult.Hits {
+		ids = append(ids, hit.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"stout", "porter"}) {
+		t.Errorf("expected [stout porter], got %v", ids)
+	}
+
+	searchRequest = bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	searchRequest.SortBy([]string{"abv", "_id"})
+	searchRequest.Fields = []string{"abv"}
+	searchResult, err = index.Search(searchRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abvs := make(map[string]interface{})
+	ids = nil
+	for _, hit := range searchResult.Hits {
+		ids = append(ids, hit.ID)
+		abvs[hit.ID] = hit.Fields["abv"]
+	}
+	// the unparseable abv is dropped, so broken sorts last
+	if !reflect.DeepEqual(ids, []string{"lager", "porter", "stout", "broken"}) {
+		t.Errorf("expected [lager porter stout broken], got %v", ids)
+	}
+	if abvs["lager"] != 4.8 || abvs["broken"] != nil {
+		t.Errorf("expected stored abv 4.8 for lager and none for broken, got %v", abvs)
+	}
+}
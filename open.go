@@ -0,0 +1,83 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+// openResult is the outcome of opening the index
+type openResult struct {
+	index   bleve.Index
+	created bool
+	err     error
+}
+
+// openIndexAsync runs open in the background, delivering its result on the
+// returned channel
+func openIndexAsync(open func() (bleve.Index, bool, error)) <-chan openResult {
+	rv := make(chan openResult, 1)
+	go func() {
+		index, created, err := open()
+		rv <- openResult{
+			index:   index,
+			created: created,
+			err:     err,
+		}
+	}()
+	return rv
+}
+
+// awaitOpen waits up to timeout for the open delivering to results to
+// finish, returning false if it did not. A timeout of 0 waits as long as the
+// open takes. An open that times out carries on, and its result can still be
+// received from results.
+func awaitOpen(results <-chan openResult, timeout time.Duration) (openResult, bool) {
+	if timeout <= 0 {
+		return <-results, true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		return result, true
+	case <-timer.C:
+		return openResult{}, false
+	}
+}
+
+// indexUnavailable is set while the server runs degraded, waiting on an
+// index open that exceeded -openTimeout
+var indexUnavailable int32
+
+// unavailableHandler responds to API requests with a 503 while the index is
+// unavailable, passing everything else, such as static files, on to next
+type unavailableHandler struct {
+	next http.Handler
+}
+
+func newUnavailableHandler(next http.Handler) *unavailableHandler {
+	return &unavailableHandler{
+		next: next,
+	}
+}
+
+func (h *unavailableHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if atomic.LoadInt32(&indexUnavailable) != 0 && strings.HasPrefix(req.URL.Path, "/api/") {
+		showError(w, req, "index is still opening, try again later", 503)
+		return
+	}
+	h.next.ServeHTTP(w, req)
+}
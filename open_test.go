@@ -0,0 +1,80 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestOpenTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slowOpen := func() (bleve.Index, bool, error) {
+		<-release
+		index, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+		return index, true, err
+	}
+
+	// the simulated slow open outlasts the timeout
+	opened := openIndexAsync(slowOpen)
+	if _, ok := awaitOpen(opened, 10*time.Millisecond); ok {
+		t.Fatal("expected the open to time out")
+	}
+
+	// but carries on, and its result arrives once it finishes
+	close(release)
+	result, ok := awaitOpen(opened, 0)
+	if !ok || result.err != nil || result.index == nil || !result.created {
+		t.Fatalf("expected the late open to succeed, got %+v", result)
+	}
+	result.index.Close()
+
+	// a fast open is unaffected
+	result, ok = awaitOpen(openIndexAsync(slowOpen), time.Second)
+	if !ok || result.err != nil {
+		t.Fatalf("expected the open to finish in time, got %+v", result)
+	}
+	result.index.Close()
+}
+
+func TestUnavailableHandler(t *testing.T) {
+	defer atomic.StoreInt32(&indexUnavailable, 0)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+	serve := func(handler http.Handler, path string) int {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve(newUnavailableHandler(next), "/api/search?q=stout"); code != http.StatusOK {
+		t.Errorf("expected status 200 before degrading, got %d", code)
+	}
+
+	atomic.StoreInt32(&indexUnavailable, 1)
+	if code := serve(newUnavailableHandler(next), "/api/search?q=stout"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 for searches while degraded, got %d", code)
+	}
+	if code := serve(newUnavailableHandler(next), "/index.html"); code != http.StatusOK {
+		t.Errorf("expected static files to be served while degraded, got %d", code)
+	}
+	if code := serve(newReadyzHandler(), "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected readyz 503 while degraded, got %d", code)
+	}
+}
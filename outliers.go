@@ -0,0 +1,123 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// lengthFields are the text fields whose length, in words, is indexed
+// alongside them, so documents can be ranked by it
+var lengthFields = []string{"name", "description"}
+
+// lengthField returns the field holding the length of field
+func lengthField(field string) string {
+	return field + "_length"
+}
+
+var lengthTokenizer = unicode.NewUnicodeTokenizer()
+
+// recordFieldLengths sets the length field of each of the lengthFields of
+// jsonDoc to the number of words in it. Missing and non-text values have a
+// length of 0, so stub documents can be found as well.
+func recordFieldLengths(jsonDoc interface{}) {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range lengthFields {
+		length := 0
+		if s, ok := doc[field].(string); ok {
+			length = len(lengthTokenizer.Tokenize([]byte(s)))
+		}
+		doc[lengthField(field)] = float64(length)
+	}
+}
+
+// outliersHandler serves GET /api/outliers?field=&order=&n=, returning the
+// n documents, 10 by default, with the longest or shortest value of field,
+// one of the lengthFields, by number of words. order is longest, the
+// default, or shortest; ties are broken by id.
+type outliersHandler struct {
+	defaultIndexName string
+}
+
+func newOutliersHandler(defaultIndexName string) *outliersHandler {
+	return &outliersHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *outliersHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	field := req.FormValue("field")
+	if field == "" {
+		field = "description"
+	}
+	measured := false
+	for _, f := range lengthFields {
+		measured = measured || f == field
+	}
+	if !measured {
+		showError(w, req, fmt.Sprintf("field '%s' has no indexed length", field), 400)
+		return
+	}
+	var sortKey string
+	switch req.FormValue("order") {
+	case "", "longest":
+		sortKey = "-" + lengthField(field)
+	case "shortest":
+		sortKey = lengthField(field)
+	default:
+		showError(w, req, fmt.Sprintf("unknown order '%s', expected longest or shortest", req.FormValue("order")), 400)
+		return
+	}
+	n, err := intParam(req, "n", 10)
+	if err != nil || n < 0 {
+		showError(w, req, fmt.Sprintf("invalid n '%s'", req.FormValue("n")), 400)
+		return
+	}
+
+	min := 0.0
+	lengthQuery := bleve.NewNumericRangeQuery(&min, nil)
+	lengthQuery.SetField(lengthField(field))
+	searchRequest := bleve.NewSearchRequestOptions(lengthQuery, n, 0, false)
+	searchRequest.SortBy([]string{sortKey, "_id"})
+	searchRequest.Fields = []string{field, lengthField(field)}
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+
+	documents := make([]map[string]interface{}, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		documents = append(documents, map[string]interface{}{
+			"id":     hit.ID,
+			"length": hit.Fields[lengthField(field)],
+			field:    hit.Fields[field],
+		})
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"documents": documents,
+	})
+}
@@ -0,0 +1,100 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestOutliers(t *testing.T) {
+	docs := map[string]interface{}{
+		"stub": map[string]interface{}{
+			"type":        "beer",
+			"name":        "Stub",
+			"description": "",
+		},
+		"missing": map[string]interface{}{
+			"type": "beer",
+			"name": "Missing",
+		},
+		"terse": map[string]interface{}{
+			"type":        "beer",
+			"name":        "Terse",
+			"description": "A stout.",
+		},
+		"verbose": map[string]interface{}{
+			"type":        "beer",
+			"name":        "Verbose",
+			"description": "A rich, dark and creamy stout, brewed with roasted barley and plenty of patience.",
+		},
+	}
+	for _, doc := range docs {
+		recordFieldLengths(doc)
+	}
+	index := newTestIndex(t, docs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("outliersTest", index)
+	defer bleveHttp.UnregisterIndexByName("outliersTest")
+
+	serve := func(rawQuery string) (int, []string, []float64) {
+		req, err := http.NewRequest("GET", "/api/outliers?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newOutliersHandler("outliersTest").ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			return rr.Code, nil, nil
+		}
+		var result struct {
+			Documents []struct {
+				ID     string  `json:"id"`
+				Length float64 `json:"length"`
+			} `json:"documents"`
+		}
+		err = json.Unmarshal(rr.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		var lengths []float64
+		for _, doc := range result.Documents {
+			ids = append(ids, doc.ID)
+			lengths = append(lengths, doc.Length)
+		}
+		return rr.Code, ids, lengths
+	}
+
+	// documents without a description count as empty
+	_, ids, lengths := serve("field=description&order=shortest&n=3")
+	if !reflect.DeepEqual(ids, []string{"missing", "stub", "terse"}) {
+		t.Errorf("expected the shortest to be [missing stub terse], got %v", ids)
+	}
+	if !reflect.DeepEqual(lengths, []float64{0, 0, 2}) {
+		t.Errorf("expected lengths [0 0 2], got %v", lengths)
+	}
+
+	_, ids, lengths = serve("n=1")
+	if !reflect.DeepEqual(ids, []string{"verbose"}) || !reflect.DeepEqual(lengths, []float64{14}) {
+		t.Errorf("expected the longest to be verbose with 14 words, got %v %v", ids, lengths)
+	}
+
+	for _, rawQuery := range []string{"field=style", "order=widest", "n=-1"} {
+		if code, _, _ := serve(rawQuery); code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s, got %d", rawQuery, code)
+		}
+	}
+}
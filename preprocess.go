@@ -0,0 +1,107 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// documentPreprocessor transforms a parsed document before it is indexed,
+// for example to compute derived fields or normalize units
+type documentPreprocessor interface {
+	Preprocess(docID string, doc map[string]interface{}) error
+}
+
+// documentPreprocessorFunc adapts an ordinary function to a
+// documentPreprocessor
+type documentPreprocessorFunc func(docID string, doc map[string]interface{}) error
+
+func (f documentPreprocessorFunc) Preprocess(docID string, doc map[string]interface{}) error {
+	return f(docID, doc)
+}
+
+var preprocessorRegistry = make(map[string]documentPreprocessor)
+
+// registerPreprocessor makes a preprocessor available by name to the
+// -preprocessors flag
+func registerPreprocessor(name string, p documentPreprocessor) {
+	if _, exists := preprocessorRegistry[name]; exists {
+		panic(fmt.Sprintf("attempted to register duplicate preprocessor '%s'", name))
+	}
+	preprocessorRegistry[name] = p
+}
+
+// preprocessorNames parses the -preprocessors flag
+func preprocessorNames() []string {
+	var rv []string
+	for _, name := range strings.Split(*preprocessors, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			rv = append(rv, name)
+		}
+	}
+	return rv
+}
+
+// checkPreprocessors returns an error when -preprocessors names a
+// preprocessor that is not registered, so a misconfiguration is caught at
+// startup rather than by every document indexed
+func checkPreprocessors() error {
+	for _, name := range preprocessorNames() {
+		if _, ok := preprocessorRegistry[name]; !ok {
+			return fmt.Errorf("no preprocessor named '%s'", name)
+		}
+	}
+	return nil
+}
+
+// preprocessDocument runs the chain of preprocessors named by
+// -preprocessors over jsonDoc
+func preprocessDocument(docID string, jsonDoc interface{}) error {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, name := range preprocessorNames() {
+		p, ok := preprocessorRegistry[name]
+		if !ok {
+			return fmt.Errorf("no preprocessor named '%s'", name)
+		}
+		err := p.Preprocess(docID, doc)
+		if err != nil {
+			return fmt.Errorf("preprocessor '%s' failed on %s: %v", name, docID, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerPreprocessor("abvCategory", documentPreprocessorFunc(abvCategory))
+}
+
+// abvCategory derives abv_category from the numeric abv field of beers
+func abvCategory(docID string, doc map[string]interface{}) error {
+	abv, ok := doc["abv"].(float64)
+	if !ok || doc["type"] != "beer" {
+		return nil
+	}
+	switch {
+	case abv <= 0:
+		doc["abv_category"] = "non-alcoholic"
+	case abv < 4.5:
+		doc["abv_category"] = "session"
+	case abv < 7:
+		doc["abv_category"] = "standard"
+	default:
+		doc["abv_category"] = "strong"
+	}
+	return nil
+}
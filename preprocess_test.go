@@ -0,0 +1,141 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestPreprocessors(t *testing.T) {
+	registerPreprocessor("testShout", documentPreprocessorFunc(
+		func(docID string, doc map[string]interface{}) error {
+			if name, ok := doc["name"].(string); ok {
+				doc["shout"] = strings.ToUpper(name)
+			}
+			return nil
+		}))
+	defer delete(preprocessorRegistry, "testShout")
+
+	defer func(orig string) { *preprocessors = orig }(*preprocessors)
+	*preprocessors = "abvCategory,testShout"
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"light.json":  `{"type":"beer","name":"Light","abv":3.2}`,
+		"barley.json": `{"type":"beer","name":"Barley Wine","abv":11.5}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err := indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// documents arriving over HTTP are preprocessed too
+	bleveHttp.RegisterIndexName("preprocessTest", index)
+	defer bleveHttp.UnregisterIndexByName("preprocessTest")
+	handler := newDocIndexHandler("preprocessTest")
+	handler.DocIDLookup = func(req *http.Request) string { return "porter" }
+	req, err := http.NewRequest("PUT", "/api/doc/porter",
+		strings.NewReader(`{"type":"beer","name":"Porter","abv":5.6}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	expected := map[string]string{
+		"light":  "session",
+		"barley": "strong",
+		"porter": "standard",
+	}
+	for docID, category := range expected {
+		termQuery := bleve.NewTermQuery(category)
+		termQuery.SetField("abv_category")
+		searchResult, err := index.Search(bleve.NewSearchRequest(termQuery))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(searchResult.Hits) != 1 || searchResult.Hits[0].ID != docID {
+			t.Errorf("expected %s in abv_category %s, got %v", docID, category, searchResult.Hits)
+		}
+	}
+
+	matchQuery := bleve.NewMatchQuery("BARLEY")
+	matchQuery.SetField("shout")
+	searchResult, err := index.Search(bleve.NewSearchRequest(matchQuery))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if searchResult.Total != 1 {
+		t.Errorf("expected derived shout field to be indexed, got %d hits", searchResult.Total)
+	}
+
+	*preprocessors = "missing"
+	if err := indexBeer(index); err == nil {
+		t.Errorf("expected error for unknown preprocessor")
+	}
+}
+
+func TestCheckPreprocessors(t *testing.T) {
+	defer func(orig string) { *preprocessors = orig }(*preprocessors)
+
+	for _, names := range []string{"", "abvCategory", " abvCategory, "} {
+		*preprocessors = names
+		if err := checkPreprocessors(); err != nil {
+			t.Errorf("expected '%s' to be valid, got %v", names, err)
+		}
+	}
+	*preprocessors = "abvCategory,missing"
+	if err := checkPreprocessors(); err == nil {
+		t.Error("expected an error for an unknown preprocessor")
+	}
+}
+
+func TestDocIndexStatusCodes(t *testing.T) {
+	defer func(orig string) { *preprocessors = orig }(*preprocessors)
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("docStatusTest", index)
+	defer bleveHttp.UnregisterIndexByName("docStatusTest")
+
+	put := func(body string) int {
+		handler := newDocIndexHandler("docStatusTest")
+		handler.DocIDLookup = func(req *http.Request) string { return "porter" }
+		req, err := http.NewRequest("PUT", "/api/doc/porter", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := put(`{"type":"beer"`); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for malformed JSON, got %d", code)
+	}
+	// a misconfigured preprocessor is not the client's fault
+	*preprocessors = "missing"
+	if code := put(`{"type":"beer","name":"Porter"}`); code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 for a preprocessing failure, got %d", code)
+	}
+}
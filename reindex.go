@@ -0,0 +1,105 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// reindexProgressKey is the internal storage key holding the name of the
+// last file covered by an unfinished indexing run
+var reindexProgressKey = []byte("_reindex_progress")
+
+// reindexProgress reports how far an indexing run got
+type reindexProgress struct {
+	Last    string `json:"last"`
+	Indexed int    `json:"indexed"`
+	Done    bool   `json:"done"`
+}
+
+// reindexing is set while an indexing run is in progress, whether the
+// initial one, one started here or one following a synonym reload, so runs
+// never overlap and one finishing cannot clear the progress of another
+var reindexing int32
+
+// reindexHandler serves POST /api/reindex, reindexing -jsonDir into the
+// index. With maxDuration, such as 30s, it stops at the first batch
+// boundary past that duration and responds with done false; the next call
+// resumes after the last file indexed, so a large reindex can run as a
+// series of bounded slices. Without it the reindex runs to completion. It
+// is refused with a 409 while another indexing run is in progress.
+//
+// Resuming relies on document ids that do not depend on the run, so a
+// bounded reindex is refused with -idStrategy sequence.
+type reindexHandler struct {
+	defaultIndexName string
+	now              func() time.Time
+}
+
+func newReindexHandler(defaultIndexName string) *reindexHandler {
+	return &reindexHandler{
+		defaultIndexName: defaultIndexName,
+		now:              time.Now,
+	}
+}
+
+func (h *reindexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	var stop func() bool
+	if maxDurationParam := req.FormValue("maxDuration"); maxDurationParam != "" {
+		maxDuration, err := time.ParseDuration(maxDurationParam)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error parsing maxDuration: %v", err), 400)
+			return
+		}
+		if *idStrategy == "sequence" {
+			showError(w, req, "a bounded reindex cannot resume with -idStrategy sequence", 400)
+			return
+		}
+		deadline := h.now().Add(maxDuration)
+		stop = func() bool {
+			return h.now().After(deadline)
+		}
+	}
+
+	if !atomic.CompareAndSwapInt32(&reindexing, 0, 1) {
+		showError(w, req, "a reindex is already running", 409)
+		return
+	}
+	defer atomic.StoreInt32(&reindexing, 0)
+
+	after, err := index.GetInternal(reindexProgressKey)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading reindex progress: %v", err), 500)
+		return
+	}
+	progress, err := indexBeerFrom(index, string(after), stop)
+	if isDiskFull(err) {
+		showError(w, req, fmt.Sprintf("disk full, reindex stopped after %s: %v", progress.Last, err), 507)
+		return
+	}
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reindexing: %v", err), 500)
+		return
+	}
+
+	mustEncode(w, progress)
+}
@@ -0,0 +1,155 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestReindexBounded(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	defer func(orig int) { *batchSize = orig }(*batchSize)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"a.json": `{"type":"beer","name":"Alpha"}`,
+		"b.json": `{"type":"beer","name":"Beta"}`,
+		"c.json": `{"type":"beer","name":"Gamma"}`,
+		"d.json": `{"type":"beer","name":"Delta"}`,
+		"e.json": `{"type":"beer","name":"Epsilon"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+	*batchSize = 2
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("reindexTest", index)
+	defer bleveHttp.UnregisterIndexByName("reindexTest")
+
+	// every reading of the clock advances it by a second, so a slice of
+	// 1.5s stops after two batches
+	clock := time.Unix(0, 0)
+	slice := func() reindexProgress {
+		req, err := http.NewRequest("POST", "/api/reindex?maxDuration=1500ms", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := newReindexHandler("reindexTest")
+		handler.now = func() time.Time {
+			clock = clock.Add(time.Second)
+			return clock
+		}
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var progress reindexProgress
+		err = json.Unmarshal(rr.Body.Bytes(), &progress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return progress
+	}
+
+	progress := slice()
+	if progress.Done || progress.Indexed != 4 || progress.Last != "d.json" {
+		t.Fatalf("expected the first slice to stop after d.json, got %+v", progress)
+	}
+	count, err := index.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 documents after the first slice, got %d", count)
+	}
+
+	progress = slice()
+	if !progress.Done || progress.Indexed != 1 || progress.Last != "e.json" {
+		t.Fatalf("expected the second slice to finish with e.json, got %+v", progress)
+	}
+	count, err = index.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected all 5 documents after the second slice, got %d", count)
+	}
+
+	// a finished reindex leaves no progress behind
+	val, err := index.GetInternal(reindexProgressKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != nil {
+		t.Errorf("expected progress cleared, got %q", val)
+	}
+}
+
+func TestReindexBoundedWhilePaused(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"a.json": `{"type":"beer","name":"Alpha"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+	defer func(orig time.Duration) { indexingGatePollInterval = orig }(indexingGatePollInterval)
+	indexingGatePollInterval = time.Millisecond
+	defer indexingPause.setPaused(false)
+	indexingPause.setPaused(true)
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("reindexTest", index)
+	defer bleveHttp.UnregisterIndexByName("reindexTest")
+
+	req, err := http.NewRequest("POST", "/api/reindex?maxDuration=1500ms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := newReindexHandler("reindexTest")
+	clock := time.Unix(0, 0)
+	handler.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rr, req)
+		close(done)
+	}()
+
+	// a paused slice returns once its time is up, releasing the guard
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a paused bounded reindex to stop at its deadline")
+	}
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var progress reindexProgress
+	err = json.Unmarshal(rr.Body.Bytes(), &progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Done || progress.Indexed != 0 {
+		t.Errorf("expected no progress while paused, got %+v", progress)
+	}
+	if atomic.LoadInt32(&reindexing) != 0 {
+		t.Error("expected the reindex guard to be released")
+	}
+}
@@ -0,0 +1,41 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+// fieldRenameMap maps source field names to the names they are indexed
+// under, as configured by -renameFields
+var fieldRenameMap map[string]string
+
+// parseFieldRenames parses a comma separated list of from=to pairs
+func parseFieldRenames(s string) (map[string]string, error) {
+	return parseFieldPairs(s, "field rename", "from=to")
+}
+
+// renameFields renames the top level fields of jsonDoc per -renameFields,
+// so the rest of indexing only sees canonical names. Renames apply to the
+// names the document arrived with, so they do not chain, and a renamed
+// value replaces any value the document already had under the new name.
+// Ids are assigned first, so -idField names a field as the source has it.
+func renameFields(jsonDoc interface{}) {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok || len(fieldRenameMap) == 0 {
+		return
+	}
+	renamed := make(map[string]interface{})
+	for from, to := range fieldRenameMap {
+		if value, ok := doc[from]; ok {
+			delete(doc, from)
+			renamed[to] = value
+		}
+	}
+	for to, value := range renamed {
+		doc[to] = value
+	}
+}
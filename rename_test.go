@@ -0,0 +1,88 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestIndexBeerRenameFields(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	defer func(orig map[string]string) { fieldRenameMap = orig }(fieldRenameMap)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"strong.json": `{"type":"beer","name":"Strong","pct_alcohol":9.5,"kind":"Tripel"}`,
+		"light.json":  `{"type":"beer","name":"Light","pct_alcohol":3.2,"kind":"Mild"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	var err error
+	fieldRenameMap, err = parseFieldRenames("pct_alcohol=abv, kind=style")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err = indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the numeric value is queryable under its new name
+	min := 8.0
+	abvQuery := bleve.NewNumericRangeQuery(&min, nil)
+	abvQuery.SetField("abv")
+	searchResult, err := index.Search(bleve.NewSearchRequest(abvQuery))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searchResult.Hits) != 1 || searchResult.Hits[0].ID != "strong" {
+		t.Errorf("expected only strong to have abv >= 8, got %v", searchResult.Hits)
+	}
+
+	// and the renamed field gets the mapping of the canonical one, keyword
+	// for style
+	styleQuery := bleve.NewTermQuery("Mild")
+	styleQuery.SetField("style")
+	searchResult, err = index.Search(bleve.NewSearchRequest(styleQuery))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searchResult.Hits) != 1 || searchResult.Hits[0].ID != "light" {
+		t.Errorf("expected style Mild to match light, got %v", searchResult.Hits)
+	}
+
+	// and nothing is left under the old one
+	oldQuery := bleve.NewNumericRangeQuery(&min, nil)
+	oldQuery.SetField("pct_alcohol")
+	searchResult, err = index.Search(bleve.NewSearchRequest(oldQuery))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if searchResult.Total != 0 {
+		t.Errorf("expected nothing indexed as pct_alcohol, got %d hits", searchResult.Total)
+	}
+}
+
+func TestRenameFieldsDoNotChain(t *testing.T) {
+	defer func(orig map[string]string) { fieldRenameMap = orig }(fieldRenameMap)
+	fieldRenameMap = map[string]string{"a": "b", "b": "c"}
+	doc := map[string]interface{}{"a": 1.0, "b": 2.0}
+	renameFields(doc)
+	if len(doc) != 2 || doc["b"] != 1.0 || doc["c"] != 2.0 {
+		t.Errorf("expected a renamed to b and b to c, got %v", doc)
+	}
+
+	if _, err := parseFieldRenames("a=b,c"); err == nil {
+		t.Errorf("expected error for a pair without =")
+	}
+}
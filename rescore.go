@@ -0,0 +1,302 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/blevesearch/bleve/search"
+)
+
+// Rescoring expressions are simple arithmetic over named variables, for
+// example:
+//
+//	score * 0.7 + rating * 0.3
+//
+// The supported syntax is:
+//
+//	numbers      decimal literals such as 3, 0.5 or 1e3
+//	variables    score (the original hit score) or the name of a numeric
+//	             stored field, such as abv or rating; names may contain
+//	             letters, digits, '_' and '.'
+//	operators    + - * / with the usual precedence, and unary minus
+//	parentheses  for grouping
+//
+// Fields missing from a hit or holding non-numeric values evaluate to 0, as
+// does division by zero.
+
+// expression is a parsed arithmetic expression
+type expression interface {
+	eval(vars map[string]float64) float64
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(vars map[string]float64) float64 {
+	return float64(e)
+}
+
+type variableExpr string
+
+func (e variableExpr) eval(vars map[string]float64) float64 {
+	return vars[string(e)]
+}
+
+type negateExpr struct {
+	operand expression
+}
+
+func (e negateExpr) eval(vars map[string]float64) float64 {
+	return -e.operand.eval(vars)
+}
+
+type binaryExpr struct {
+	op          byte
+	left, right expression
+}
+
+func (e binaryExpr) eval(vars map[string]float64) float64 {
+	l := e.left.eval(vars)
+	r := e.right.eval(vars)
+	switch e.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	case '/':
+		if r == 0 {
+			return 0
+		}
+		return l / r
+	}
+	return 0
+}
+
+// expressionVariables returns the names of the variables used in e
+func expressionVariables(e expression) []string {
+	var rv []string
+	seen := make(map[string]bool)
+	var walk func(e expression)
+	walk = func(e expression) {
+		switch e := e.(type) {
+		case variableExpr:
+			if !seen[string(e)] {
+				seen[string(e)] = true
+				rv = append(rv, string(e))
+			}
+		case negateExpr:
+			walk(e.operand)
+		case binaryExpr:
+			walk(e.left)
+			walk(e.right)
+		}
+	}
+	walk(e)
+	return rv
+}
+
+// parseExpression parses s using the syntax described above
+func parseExpression(s string) (expression, error) {
+	p := &expressionParser{input: s}
+	p.next()
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected '%s' at offset %d", p.tok, p.tokPos)
+	}
+	return e, nil
+}
+
+type expressionParser struct {
+	input  string
+	pos    int
+	tok    string
+	tokPos int
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || c == '.' && !first ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' && !first
+}
+
+func isNumberByte(c byte) bool {
+	return '0' <= c && c <= '9' || c == '.'
+}
+
+func isTwoByteOperator(s string) bool {
+	switch s {
+	case "==", "!=", "<=", ">=", "&&", "||":
+		return true
+	}
+	return false
+}
+
+// next advances to the next token, leaving "" at the end of input
+func (p *expressionParser) next() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+	p.tokPos = p.pos
+	if p.pos >= len(p.input) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	c := p.input[p.pos]
+	switch {
+	case isNumberByte(c):
+		for p.pos < len(p.input) && isNumberByte(p.input[p.pos]) {
+			p.pos++
+		}
+		// exponent
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.input) && isNumberByte(p.input[p.pos]) {
+				p.pos++
+			}
+		}
+	case isIdentByte(c, true):
+		for p.pos < len(p.input) && isIdentByte(p.input[p.pos], false) {
+			p.pos++
+		}
+	case c == '"':
+		// string literal, used by filter expressions
+		p.pos++
+		for p.pos < len(p.input) && p.input[p.pos] != '"' {
+			p.pos++
+		}
+		if p.pos < len(p.input) {
+			p.pos++
+		}
+	case p.pos+1 < len(p.input) && isTwoByteOperator(p.input[p.pos:p.pos+2]):
+		p.pos += 2
+	default:
+		p.pos++
+	}
+	p.tok = p.input[start:p.pos]
+}
+
+// parseSum handles + and -
+func (p *expressionParser) parseSum() (expression, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok[0]
+		p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseProduct handles * and /
+func (p *expressionParser) parseProduct() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op := p.tok[0]
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (expression, error) {
+	if p.tok == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negateExpr{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (expression, error) {
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		p.next()
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("expected ')' at offset %d", p.tokPos)
+		}
+		p.next()
+		return e, nil
+	case isNumberByte(tok[0]):
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at offset %d", tok, p.tokPos)
+		}
+		p.next()
+		return numberExpr(f), nil
+	case isIdentByte(tok[0], true):
+		p.next()
+		return variableExpr(tok), nil
+	}
+	return nil, fmt.Errorf("unexpected '%s' at offset %d", tok, p.tokPos)
+}
+
+// rescoreHits replaces the score of each hit with the value of e, evaluated
+// with score bound to the original score and any other variables bound to
+// the hit's stored fields, then re-sorts the hits by their new score
+func rescoreHits(hits search.DocumentMatchCollection, e expression) {
+	variables := expressionVariables(e)
+	for _, hit := range hits {
+		vars := make(map[string]float64, len(variables))
+		for _, v := range variables {
+			if v == "score" {
+				vars[v] = hit.Score
+			} else if f, ok := hit.Fields[v].(float64); ok {
+				vars[v] = f
+			}
+		}
+		hit.Score = e.eval(vars)
+	}
+	sort.Stable(hits)
+}
+
+// rescoreFields returns the stored fields needed to evaluate e
+func rescoreFields(e expression) []string {
+	var rv []string
+	for _, v := range expressionVariables(e) {
+		if v != "score" {
+			rv = append(rv, v)
+		}
+	}
+	return rv
+}
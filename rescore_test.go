@@ -0,0 +1,133 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+)
+
+func TestParseExpression(t *testing.T) {
+	vars := map[string]float64{"score": 2, "rating": 4}
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"score * 0.7 + rating * 0.3", 2.6},
+		{"-score + 10", 8},
+		{"rating / 0", 0},
+		{"missing + 1", 1},
+		{"1e1 - 2.5", 7.5},
+	}
+	for _, test := range tests {
+		e, err := parseExpression(test.input)
+		if err != nil {
+			t.Errorf("error parsing '%s': %v", test.input, err)
+			continue
+		}
+		actual := e.eval(vars)
+		if actual < test.expected-1e-9 || actual > test.expected+1e-9 {
+			t.Errorf("expected '%s' to be %f, got %f", test.input, test.expected, actual)
+		}
+	}
+
+	for _, invalid := range []string{"", "1 +", "(1", "1 2", "score $ 2"} {
+		_, err := parseExpression(invalid)
+		if err == nil {
+			t.Errorf("expected error parsing '%s'", invalid)
+		}
+	}
+}
+
+func TestRescoreSearch(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"stout": map[string]interface{}{
+			"type":   "beer",
+			"name":   "Stout",
+			"rating": 1.0,
+		},
+		"oatmeal-stout": map[string]interface{}{
+			"type":   "beer",
+			"name":   "Imperial Russian Oatmeal Stout",
+			"rating": 5.0,
+		},
+	})
+	defer index.Close()
+
+	q := bleve.NewMatchQuery("stout")
+	q.SetField("name")
+
+	// by text relevance alone the shorter name wins
+	searchResult, err := index.Search(bleve.NewSearchRequest(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searchResult.Hits) != 2 || searchResult.Hits[0].ID != "stout" {
+		t.Fatalf("expected stout to rank first, got %v", searchResult.Hits)
+	}
+
+	// weighting by rating flips the order
+	e, err := parseExpression("score * 0.7 + rating * 0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rescore := func(hits search.DocumentMatchCollection) search.DocumentMatchCollection {
+		rescoreHits(hits, e)
+		return hits
+	}
+	searchRequest := bleve.NewSearchRequestOptions(q, 10, 0, false)
+	searchRequest.Fields = rescoreFields(e)
+	rescored, err := windowSearch(index.Search, searchRequest, 10, rescore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rescored.Hits) != 2 || rescored.Hits[0].ID != "oatmeal-stout" {
+		t.Fatalf("expected oatmeal-stout to rank first after rescoring, got %v", rescored.Hits)
+	}
+	for _, hit := range rescored.Hits {
+		original := 0.0
+		for _, orig := range searchResult.Hits {
+			if orig.ID == hit.ID {
+				original = orig.Score
+			}
+		}
+		expected := original*0.7 + hit.Fields["rating"].(float64)*0.3
+		if hit.Score < expected-1e-9 || hit.Score > expected+1e-9 {
+			t.Errorf("expected %s to score %f, got %f", hit.ID, expected, hit.Score)
+		}
+	}
+
+	// paging applies to the re-sorted window
+	searchRequest = bleve.NewSearchRequestOptions(q, 1, 1, false)
+	searchRequest.Fields = rescoreFields(e)
+	rescored, err = windowSearch(index.Search, searchRequest, 10, rescore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rescored.Hits) != 1 || rescored.Hits[0].ID != "stout" {
+		t.Errorf("expected second page to hold stout, got %v", rescored.Hits)
+	}
+
+	// negative paging is treated as 0 rather than slicing out of range
+	searchRequest = bleve.NewSearchRequestOptions(q, 1, 0, false)
+	searchRequest.From = -5
+	searchRequest.Fields = rescoreFields(e)
+	rescored, err = windowSearch(index.Search, searchRequest, 10, rescore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rescored.Hits) != 1 || rescored.Hits[0].ID != "oatmeal-stout" {
+		t.Errorf("expected the first page for a negative from, got %v", rescored.Hits)
+	}
+}
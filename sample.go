@@ -0,0 +1,121 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// samplePageSize is the number of ids read per page while sampling
+var samplePageSize = 1000
+
+// sampleHandler serves GET /api/sample?n=<count>, returning the stored
+// fields of n distinct documents chosen at random, or of every document if
+// there are no more than n. n defaults to 10.
+type sampleHandler struct {
+	defaultIndexName string
+}
+
+func newSampleHandler(defaultIndexName string) *sampleHandler {
+	return &sampleHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *sampleHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	n, err := intParam(req, "n", 10)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing n: %v", err), 400)
+		return
+	}
+	if n < 0 {
+		showError(w, req, "n cannot be negative", 400)
+		return
+	}
+
+	ids, err := sampleIDs(index, n)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error sampling documents: %v", err), 500)
+		return
+	}
+
+	documents := make([]map[string]interface{}, 0, len(ids))
+	if len(ids) > 0 {
+		searchRequest := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(ids), len(ids), 0, false)
+		searchRequest.Fields = []string{"*"}
+		searchResult, err := index.Search(searchRequest)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error loading documents: %v", err), 500)
+			return
+		}
+		for _, hit := range searchResult.Hits {
+			documents = append(documents, map[string]interface{}{
+				"id":     hit.ID,
+				"fields": hit.Fields,
+			})
+		}
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"documents": documents,
+	})
+}
+
+// sampleIDs picks n distinct document ids uniformly at random, by reservoir
+// sampling the ids of every document, read a page at a time in id order.
+// Asking for more documents than the index holds returns them all.
+func sampleIDs(index bleve.Index, n int) ([]string, error) {
+	count, err := index.DocCount()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) > count {
+		n = int(count)
+	}
+	reservoir := make([]string, 0, n)
+	if n == 0 {
+		return reservoir, nil
+	}
+	seen := 0
+	var after []string
+	for {
+		searchRequest := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), samplePageSize, 0, false)
+		searchRequest.SortBy([]string{"_id"})
+		searchRequest.SearchAfter = after
+		searchResult, err := index.Search(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range searchResult.Hits {
+			if len(reservoir) < n {
+				reservoir = append(reservoir, hit.ID)
+			} else if j := rand.Intn(seen + 1); j < n {
+				reservoir[j] = hit.ID
+			}
+			seen++
+		}
+		if len(searchResult.Hits) < samplePageSize {
+			return reservoir, nil
+		}
+		after = []string{searchResult.Hits[len(searchResult.Hits)-1].ID}
+	}
+}
@@ -0,0 +1,93 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestSample(t *testing.T) {
+	docs := make(map[string]interface{})
+	for i := 0; i < 25; i++ {
+		docs[fmt.Sprintf("beer-%02d", i)] = map[string]interface{}{
+			"type": "beer",
+			"name": fmt.Sprintf("Beer %d", i),
+		}
+	}
+	index := newTestIndex(t, docs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("sampleTest", index)
+	defer bleveHttp.UnregisterIndexByName("sampleTest")
+
+	// read several pages to cover paging through the ids
+	defer func(orig int) { samplePageSize = orig }(samplePageSize)
+	samplePageSize = 7
+
+	for _, test := range []struct {
+		n      int
+		expect int
+	}{
+		{n: 0, expect: 0},
+		{n: 10, expect: 10},
+		{n: 25, expect: 25},
+		{n: 40, expect: 25},
+		// far more than the index holds, or could ever be allocated
+		{n: 9000000000000000000, expect: 25},
+	} {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/api/sample?n=%d", test.n), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newSampleHandler("sampleTest").ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var result struct {
+			Documents []struct {
+				ID     string                 `json:"id"`
+				Fields map[string]interface{} `json:"fields"`
+			} `json:"documents"`
+		}
+		err = json.Unmarshal(rr.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Documents) != test.expect {
+			t.Errorf("expected %d documents for n=%d, got %d", test.expect, test.n, len(result.Documents))
+		}
+		seen := make(map[string]bool)
+		for _, doc := range result.Documents {
+			if seen[doc.ID] {
+				t.Errorf("document %s sampled twice for n=%d", doc.ID, test.n)
+			}
+			seen[doc.ID] = true
+			if _, ok := docs[doc.ID]; !ok || doc.Fields["name"] == nil {
+				t.Errorf("unexpected document %s: %v", doc.ID, doc.Fields)
+			}
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/api/sample?n=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newSampleHandler("sampleTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for negative n, got %d", rr.Code)
+	}
+}
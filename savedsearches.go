@@ -0,0 +1,231 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// savedSearchStore holds named search requests, persisted as a JSON object
+// mapping names to requests in the file at path. Execution counts are kept
+// in memory only, by this process, and start from zero on every restart.
+type savedSearchStore struct {
+	m          sync.Mutex
+	path       string
+	searches   map[string]json.RawMessage
+	executions map[string]uint64
+}
+
+// newSavedSearchStore loads the saved searches at path, a missing file
+// holds none
+func newSavedSearchStore(path string) (*savedSearchStore, error) {
+	rv := &savedSearchStore{
+		path:       path,
+		searches:   make(map[string]json.RawMessage),
+		executions: make(map[string]uint64),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rv, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &rv.searches)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing saved searches '%s': %v", path, err)
+	}
+	return rv, nil
+}
+
+// save stores request under name, replacing any search of that name, and
+// rewrites the file
+func (s *savedSearchStore) save(name string, request json.RawMessage) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	searches := make(map[string]json.RawMessage, len(s.searches)+1)
+	for k, v := range s.searches {
+		searches[k] = v
+	}
+	searches[name] = request
+	data, err := json.MarshalIndent(searches, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write a new file and rename it over the old one, so a failed write
+	// cannot lose the searches already saved
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return err
+	}
+	s.searches = searches
+	return nil
+}
+
+// lookup returns the request saved under name
+func (s *savedSearchStore) lookup(name string) (json.RawMessage, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	request, ok := s.searches[name]
+	return request, ok
+}
+
+// countExecution counts a successful execution of the search saved under
+// name, returning the count so far
+func (s *savedSearchStore) countExecution(name string) uint64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.executions[name]++
+	return s.executions[name]
+}
+
+func (s *savedSearchStore) list() map[string]interface{} {
+	s.m.Lock()
+	defer s.m.Unlock()
+	rv := make(map[string]interface{}, len(s.searches))
+	for name, request := range s.searches {
+		rv[name] = map[string]interface{}{
+			"request":    request,
+			"executions": s.executions[name],
+		}
+	}
+	return rv
+}
+
+// saveSearchHandler serves POST /api/saved_searches, saving the search
+// request in the body under a name:
+//
+//	{"name": "stouts", "request": {"query": {"match": "stout"},
+//	    "facets": {...}, "sort": [...]}}
+//
+// The request takes the same form as a POST /api/search body.
+type saveSearchHandler struct {
+	store *savedSearchStore
+}
+
+func newSaveSearchHandler(store *savedSearchStore) *saveSearchHandler {
+	return &saveSearchHandler{
+		store: store,
+	}
+}
+
+func (h *saveSearchHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	// read the request body
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading request body: %v", err), 400)
+		return
+	}
+
+	var saveRequest struct {
+		Name    string          `json:"name"`
+		Request json.RawMessage `json:"request"`
+	}
+	err = json.Unmarshal(requestBody, &saveRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing request body as JSON: %v", err), 400)
+		return
+	}
+	if saveRequest.Name == "" {
+		showError(w, req, "saved search name cannot be empty", 400)
+		return
+	}
+
+	// reject requests that could never run
+	var searchRequest bleve.SearchRequest
+	err = json.Unmarshal(saveRequest.Request, &searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing query: %v", err), 400)
+		return
+	}
+
+	err = h.store.save(saveRequest.Name, saveRequest.Request)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error saving search: %v", err), 500)
+		return
+	}
+
+	rv := struct {
+		Status string `json:"status"`
+	}{
+		Status: "ok",
+	}
+	mustEncode(w, rv)
+}
+
+// listSavedSearchesHandler serves GET /api/saved_searches, returning each
+// saved search with the number of times this process has run it
+// successfully. The counts are not persisted, they restart from zero with
+// the process and are not shared between instances.
+type listSavedSearchesHandler struct {
+	store *savedSearchStore
+}
+
+func newListSavedSearchesHandler(store *savedSearchStore) *listSavedSearchesHandler {
+	return &listSavedSearchesHandler{
+		store: store,
+	}
+}
+
+func (h *listSavedSearchesHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	mustEncode(w, h.store.list())
+}
+
+// runSavedSearchHandler serves GET /api/saved_searches/{name}, executing the
+// saved search as POST /api/search would. Only executions responding with a
+// result are counted, not failures or 304s.
+type runSavedSearchHandler struct {
+	defaultIndexName string
+	store            *savedSearchStore
+	NameLookup       func(req *http.Request) string
+}
+
+func newRunSavedSearchHandler(defaultIndexName string, store *savedSearchStore) *runSavedSearchHandler {
+	return &runSavedSearchHandler{
+		defaultIndexName: defaultIndexName,
+		store:            store,
+	}
+}
+
+func (h *runSavedSearchHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	var name string
+	if h.NameLookup != nil {
+		name = h.NameLookup(req)
+	}
+	request, ok := h.store.lookup(name)
+	if !ok {
+		showError(w, req, fmt.Sprintf("no saved search named '%s'", name), 404)
+		return
+	}
+
+	if serveSearchRequest(w, req, index, request) {
+		h.store.countExecution(name)
+	}
+}
@@ -0,0 +1,169 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestSavedSearches(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("savedSearchTest", index)
+	defer bleveHttp.UnregisterIndexByName("savedSearchTest")
+
+	dir, err := ioutil.TempDir("", "beer-search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "saved_searches.json")
+
+	store, err := newSavedSearchStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(body string) int {
+		req, err := http.NewRequest("POST", "/api/saved_searches", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newSaveSearchHandler(store).ServeHTTP(rr, req)
+		return rr.Code
+	}
+	runIfNoneMatch := func(name, etag string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/saved_searches/"+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		handler := newRunSavedSearchHandler("savedSearchTest", store)
+		handler.NameLookup = func(*http.Request) string { return name }
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	run := func(name string) (int, []byte) {
+		rr := runIfNoneMatch(name, "")
+		return rr.Code, rr.Body.Bytes()
+	}
+	executions := func() map[string]uint64 {
+		req, err := http.NewRequest("GET", "/api/saved_searches", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newListSavedSearchesHandler(store).ServeHTTP(rr, req)
+		var list map[string]struct {
+			Executions uint64 `json:"executions"`
+		}
+		err = json.Unmarshal(rr.Body.Bytes(), &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv := make(map[string]uint64, len(list))
+		for name, search := range list {
+			rv[name] = search.Executions
+		}
+		return rv
+	}
+
+	for _, body := range []string{
+		`{"request": {"query": {"match": "stout"}}}`,
+		`{"name": "bad", "request": {"query": {"nonsense": 1}}}`,
+		`not json`,
+	} {
+		if code := save(body); code != http.StatusBadRequest {
+			t.Errorf("expected status 400 saving %s, got %d", body, code)
+		}
+	}
+
+	code := save(`{"name": "stouts", "request": {"query": {"match": "stout"},
+		"facets": {"styles": {"field": "style", "size": 5}}}}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200 saving, got %d", code)
+	}
+
+	for i := 0; i < 2; i++ {
+		code, body := run("stouts")
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200 running, got %d: %s", code, body)
+		}
+		var result struct {
+			Hits []struct {
+				ID string `json:"id"`
+			} `json:"hits"`
+			Facets map[string]interface{} `json:"facets"`
+		}
+		err = json.Unmarshal(body, &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Hits) != 1 || result.Hits[0].ID != "guinness" {
+			t.Errorf("expected only guinness, got %v", result.Hits)
+		}
+		if _, ok := result.Facets["styles"]; !ok {
+			t.Errorf("expected the saved facet, got %v", result.Facets)
+		}
+	}
+	if code, _ := run("missing"); code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing saved search, got %d", code)
+	}
+
+	if counts := executions(); len(counts) != 1 || counts["stouts"] != 2 {
+		t.Errorf("expected stouts run twice, got %v", counts)
+	}
+
+	// revalidations and failures are not counted
+	etag := runIfNoneMatch("stouts", "").Header().Get("ETag")
+	if rr := runIfNoneMatch("stouts", etag); rr.Code != http.StatusNotModified {
+		t.Errorf("expected status 304 revalidating, got %d", rr.Code)
+	}
+	code = save(`{"name": "wide", "request": {"query": {"disjuncts": [
+		{"term": "a"}, {"term": "b"}, {"term": "c"}]}}}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200 saving, got %d", code)
+	}
+	func(orig int) {
+		defer func() { *maxClauses = orig }()
+		*maxClauses = 2
+		if code, _ := run("wide"); code != http.StatusBadRequest {
+			t.Errorf("expected status 400 past the clause limit, got %d", code)
+		}
+	}(*maxClauses)
+	if counts := executions(); counts["stouts"] != 3 || counts["wide"] != 0 {
+		t.Errorf("expected only successful runs counted, got %v", counts)
+	}
+
+	// saved searches outlive the store, their counts do not
+	store, err = newSavedSearchStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, body := run("stouts"); code != http.StatusOK {
+		t.Fatalf("expected status 200 after reloading, got %d: %s", code, body)
+	}
+	if counts := executions(); counts["stouts"] != 1 {
+		t.Errorf("expected execution count to restart, got %v", counts)
+	}
+}
@@ -0,0 +1,641 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+const (
+	strategyExact = "exact"
+	strategyFuzzy = "fuzzy"
+)
+
+const (
+	// exactCaseNameField holds beer names tokenized without lowercasing
+	exactCaseNameField = "nameExact"
+	exactCaseAnalyzer  = "exactCase"
+)
+
+// searchResponse is a search result annotated with how it was produced
+type searchResponse struct {
+	*bleve.SearchResult
+	Strategy string `json:"strategy"`
+	TimedOut bool   `json:"timed_out"`
+}
+
+// idsResponse is the idsOnly form of a search response
+type idsResponse struct {
+	IDs      []string `json:"ids"`
+	Total    uint64   `json:"total_hits"`
+	Strategy string   `json:"strategy"`
+	TimedOut bool     `json:"timed_out"`
+}
+
+// searchRequestHandler serves POST /api/search, executing a JSON search
+// request like bleve's own search handler after rewriting any field aliases
+// it names. Queries with more clauses than -maxClauses are rejected, and
+// requests without a highlight get the default one, see -highlightByDefault.
+// Responses carry an ETag, a POST whose If-None-Match lists the current one
+// gets a 412 rather than a 304, see cache.go.
+type searchRequestHandler struct {
+	defaultIndexName string
+}
+
+func newSearchRequestHandler(defaultIndexName string) *searchRequestHandler {
+	return &searchRequestHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *searchRequestHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	// read the request body
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading request body: %v", err), 400)
+		return
+	}
+
+	serveSearchRequest(w, req, index, requestBody)
+}
+
+// serveSearchRequest parses requestBody as a JSON search request, applies
+// field aliases, the default highlight and the clause limit, executes it
+// and writes the result. It reports whether a result was written, rather
+// than an error, a 304 or a 412.
+func serveSearchRequest(w http.ResponseWriter, req *http.Request, index bleve.Index, requestBody []byte) bool {
+	etag := searchETag("POST " + string(requestBody))
+	if notModified(w, req, etag) {
+		return false
+	}
+
+	// parse the request
+	var searchRequest bleve.SearchRequest
+	err := json.Unmarshal(requestBody, &searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing query: %v", err), 400)
+		return false
+	}
+	err = aliasSearchRequest(&searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing query: %v", err), 400)
+		return false
+	}
+
+	if searchRequest.Highlight == nil {
+		searchRequest.Highlight = defaultHighlight()
+	}
+
+	// validate the query
+	err = checkClauseLimit(searchRequest.Query)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error validating query: %v", err), 400)
+		return false
+	}
+	if srqv, ok := searchRequest.Query.(query.ValidatableQuery); ok {
+		err = srqv.Validate()
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error validating query: %v", err), 400)
+			return false
+		}
+	}
+
+	// execute the query
+	fieldUsage.record(searchRequest.Query)
+	searchRequest.Query = withCachedAnalysis(searchRequest.Query, analyses)
+	searchResult, err := index.Search(&searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return false
+	}
+	setCacheValidators(w, etag)
+	mustEncode(w, searchResult)
+	return true
+}
+
+// searchQueryHandler is a convenience wrapper around search, building the
+// search request from URL parameters instead of a JSON body.
+//
+// Parameters:
+//
+//	q                 the text to match (required); queries shorter than
+//	                  -minQueryLength are rejected, or match nothing, as set
+//	                  by -shortQueryPolicy
+//	field             restrict matching to this field, or the field it is
+//	                  an alias for
+//	crossFields       match q across these comma separated fields, each
+//	                  optionally boosted with ^boost, as if they were one
+//	                  field, instead of field, see crossfields.go
+//	lang              match q against descriptions in this language, with
+//	                  its analyzer, instead of field, see lang.go
+//	size, from        paging, defaulting to 10 and 0
+//	sort              comma separated fields to order hits by instead of
+//	                  score, each prefixed with - for descending order, such
+//	                  as style,-abv; see sortableFields
+//	fuzzyFallback     when set, a search returning fewer than minHits results
+//	                  is re-run with fuzzy matching
+//	minHits           overrides -fuzzyFallbackMinHits
+//	fuzziness         overrides -fuzziness
+//	fuzzyPrefix       overrides -fuzzyPrefix, the number of leading characters
+//	                  of each term that fuzzy matching leaves unchanged
+//	rescore           an expression used to rescore the top hits, see rescore.go
+//	decay             lower the scores of the top hits by the age of their
+//	                  updated time along a linear, exp or gauss curve, after
+//	                  any rescore, see decay.go
+//	decayScale        the age past decayOffset, such as 720h, at which the
+//	                  decay reaches decayValue (required with decay)
+//	decayOffset       ages up to this duration are not decayed, default 0
+//	decayValue        the factor reached at decayScale, default 0.5
+//	decayOrigin       the RFC3339 time ages are measured from, default now
+//	dedupByName       collapse hits sharing a normalized name, keeping the
+//	                  highest scoring one
+//	exactCase         match q against name, boosting names with the same case
+//	exactCaseBoost    overrides -exactCaseBoost
+//	idsOnly           respond with just the ordered hit IDs and the total,
+//	                  without highlighting or loading stored fields
+//	window            overrides -resultWindow, the number of top hits to which
+//	                  rescore, decay and dedupByName apply
+//	highlight         overrides -highlightByDefault, highlighting the
+//	                  -highlightFields
+//	timeout           give up on searches taking longer than this duration,
+//	                  such as 200ms, responding with a 504
+//	partialOnTimeout  respond to a timed out search with the hits collected
+//	                  so far and timed_out set, see timeout.go. Partial hits
+//	                  are ordered by score without stored fields or
+//	                  highlighting, so it cannot be combined with sort,
+//	                  rescore, decay, dedupByName or highlight.
+//
+// Queries built with more clauses than -maxClauses are rejected. Complete
+// responses carry an ETag to revalidate them with, see cache.go, unless they
+// decay from the current time, without a decayOrigin.
+type searchQueryHandler struct {
+	defaultIndexName string
+	withTimeout      func(context.Context, time.Duration) (context.Context, context.CancelFunc)
+}
+
+func newSearchQueryHandler(defaultIndexName string) *searchQueryHandler {
+	return &searchQueryHandler{
+		defaultIndexName: defaultIndexName,
+		withTimeout:      context.WithTimeout,
+	}
+}
+
+func (h *searchQueryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+	// scores decayed from the time of the search change with every search
+	cacheable := req.FormValue("decay") == "" || req.FormValue("decayOrigin") != ""
+	etag := searchETag("GET " + req.URL.Query().Encode())
+	if cacheable && notModified(w, req, etag) {
+		return
+	}
+
+	q := req.FormValue("q")
+	if q == "" {
+		showError(w, req, "missing required parameter 'q'", 400)
+		return
+	}
+	tooShort := isShortQuery(q)
+	if tooShort && *shortQueryPolicy != "empty" {
+		showError(w, req, fmt.Sprintf("query '%s' is shorter than the minimum length of %d", q, *minQueryLength), 400)
+		return
+	}
+	field := req.FormValue("field")
+	if lang := req.FormValue("lang"); lang != "" {
+		err := checkLanguage(lang)
+		if err != nil {
+			showError(w, req, err.Error(), 400)
+			return
+		}
+		field = languageField(lang)
+	}
+	size, err := intParam(req, "size", 10)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+	from, err := intParam(req, "from", 0)
+	if err != nil || from < 0 {
+		showError(w, req, fmt.Sprintf("invalid from '%s'", req.FormValue("from")), 400)
+		return
+	}
+	minHits, err := intParam(req, "minHits", *fuzzyFallbackMinHits)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing minHits: %v", err), 400)
+		return
+	}
+	fuzziness, err := intParam(req, "fuzziness", *defaultFuzziness)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing fuzziness: %v", err), 400)
+		return
+	}
+	fuzzyPrefix, err := intParam(req, "fuzzyPrefix", *defaultFuzzyPrefix)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing fuzzyPrefix: %v", err), 400)
+		return
+	}
+
+	var sortOrder []string
+	if sortParam := req.FormValue("sort"); sortParam != "" {
+		sortOrder, err = parseSortOrder(sortParam)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error parsing sort: %v", err), 400)
+			return
+		}
+		if req.FormValue("rescore") != "" {
+			showError(w, req, "sort cannot be combined with rescore", 400)
+			return
+		}
+		if req.FormValue("decay") != "" {
+			showError(w, req, "sort cannot be combined with decay", 400)
+			return
+		}
+	}
+
+	window, err := intParam(req, "window", *defaultResultWindow)
+	if err != nil || window < 0 {
+		showError(w, req, fmt.Sprintf("invalid window '%s'", req.FormValue("window")), 400)
+		return
+	}
+
+	// post-processing steps applied to the top window hits
+	var fields []string
+	var processors []func(search.DocumentMatchCollection) search.DocumentMatchCollection
+	if rescoreParam := req.FormValue("rescore"); rescoreParam != "" {
+		rescore, err := parseExpression(rescoreParam)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error parsing rescore: %v", err), 400)
+			return
+		}
+		fields = append(fields, rescoreFields(rescore)...)
+		processors = append(processors, func(hits search.DocumentMatchCollection) search.DocumentMatchCollection {
+			rescoreHits(hits, rescore)
+			return hits
+		})
+	}
+	decay, err := parseDecay(req, time.Now())
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error parsing decay: %v", err), 400)
+		return
+	}
+	if decay != nil {
+		fields = append(fields, decayField)
+		processors = append(processors, func(hits search.DocumentMatchCollection) search.DocumentMatchCollection {
+			decayHits(hits, decay)
+			return hits
+		})
+	}
+	if req.FormValue("dedupByName") != "" {
+		fields = append(fields, "name")
+		processors = append(processors, dedupHitsByName)
+	}
+
+	highlight := defaultHighlight()
+	if highlightParam := req.FormValue("highlight"); highlightParam != "" {
+		on, err := strconv.ParseBool(highlightParam)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error parsing highlight: %v", err), 400)
+			return
+		}
+		highlight = nil
+		if on {
+			highlight = newFieldsHighlight()
+		}
+	}
+	// IDs need neither highlighting nor any stored fields beyond those the
+	// post-processing reads
+	idsOnly := req.FormValue("idsOnly") != ""
+	if idsOnly {
+		highlight = nil
+	}
+
+	var timeout time.Duration
+	if timeoutParam := req.FormValue("timeout"); timeoutParam != "" {
+		timeout, err = time.ParseDuration(timeoutParam)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error parsing timeout: %v", err), 400)
+			return
+		}
+	}
+	partialOnTimeout := req.FormValue("partialOnTimeout") != ""
+	if partialOnTimeout {
+		// partial hits are ordered by score and carry no fields, see timeout.go
+		for _, param := range []string{"sort", "rescore", "decay", "dedupByName"} {
+			if req.FormValue(param) != "" {
+				showError(w, req, fmt.Sprintf("partialOnTimeout cannot be combined with %s", param), 400)
+				return
+			}
+		}
+		if req.FormValue("highlight") != "" && highlight != nil {
+			showError(w, req, "partialOnTimeout cannot be combined with highlight", 400)
+			return
+		}
+	}
+
+	timedOut := false
+	execute := func(searchRequest *bleve.SearchRequest) (*bleve.SearchResult, error) {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = h.withTimeout(ctx, timeout)
+			defer cancel()
+		}
+		searchResult, partial, err := timedSearch(ctx, index, searchRequest, partialOnTimeout)
+		timedOut = partial
+		return searchResult, err
+	}
+	runSearch := func(q query.Query) (*bleve.SearchResult, error) {
+		searchRequest := bleve.NewSearchRequestOptions(withCachedAnalysis(q, analyses), size, from, false)
+		searchRequest.Highlight = highlight
+		if sortOrder != nil {
+			searchRequest.SortBy(sortOrder)
+		}
+		if len(processors) == 0 {
+			return execute(searchRequest)
+		}
+		searchRequest.Fields = fields
+		return windowSearch(execute, searchRequest, window,
+			func(hits search.DocumentMatchCollection) search.DocumentMatchCollection {
+				for _, process := range processors {
+					hits = process(hits)
+				}
+				return hits
+			})
+	}
+
+	var exactQuery query.Query = buildMatchQuery(q, field)
+	if crossFieldsParam := req.FormValue("crossFields"); crossFieldsParam != "" {
+		crossFields, err := parseCrossFields(crossFieldsParam)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error parsing crossFields: %v", err), 400)
+			return
+		}
+		exactQuery = buildCrossFieldsQuery(q, crossFields)
+	}
+	if req.FormValue("exactCase") != "" {
+		exactCaseBoost := *defaultExactCaseBoost
+		if boostParam := req.FormValue("exactCaseBoost"); boostParam != "" {
+			exactCaseBoost, err = strconv.ParseFloat(boostParam, 64)
+			if err != nil {
+				showError(w, req, fmt.Sprintf("error parsing exactCaseBoost: %v", err), 400)
+				return
+			}
+		}
+		exactQuery = buildExactCaseQuery(q, exactCaseBoost)
+	}
+	if tooShort {
+		exactQuery = bleve.NewMatchNoneQuery()
+	}
+	err = checkClauseLimit(exactQuery)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error validating query: %v", err), 400)
+		return
+	}
+
+	// run the exact search first
+	fieldUsage.record(exactQuery)
+	searchResult, err := runSearch(exactQuery)
+	if err == context.DeadlineExceeded {
+		showError(w, req, "search timed out", 504)
+		return
+	} else if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+	strategy := strategyExact
+
+	// escalate to fuzzy matching when the exact search came up short
+	if req.FormValue("fuzzyFallback") != "" && searchResult.Total < uint64(minHits) && !timedOut && !tooShort {
+		fuzzyQuery := buildFuzzyQuery(q, field, fuzziness, fuzzyPrefix)
+		err = checkClauseLimit(fuzzyQuery)
+		if err != nil {
+			showError(w, req, fmt.Sprintf("error validating fuzzy query: %v", err), 400)
+			return
+		}
+		searchResult, err = runSearch(fuzzyQuery)
+		if err == context.DeadlineExceeded {
+			showError(w, req, "fuzzy search timed out", 504)
+			return
+		} else if err != nil {
+			showError(w, req, fmt.Sprintf("error executing fuzzy query: %v", err), 500)
+			return
+		}
+		strategy = strategyFuzzy
+	}
+
+	// a partial response must not be revalidated in place of a complete one
+	if !timedOut && cacheable {
+		setCacheValidators(w, etag)
+	}
+
+	if idsOnly {
+		ids := make([]string, len(searchResult.Hits))
+		for i, hit := range searchResult.Hits {
+			ids[i] = hit.ID
+		}
+		mustEncode(w, idsResponse{
+			IDs:      ids,
+			Total:    searchResult.Total,
+			Strategy: strategy,
+			TimedOut: timedOut,
+		})
+		return
+	}
+
+	mustEncode(w, searchResponse{
+		SearchResult: searchResult,
+		Strategy:     strategy,
+		TimedOut:     timedOut,
+	})
+}
+
+// highlightFieldList parses the -highlightFields flag
+func highlightFieldList() []string {
+	var rv []string
+	for _, field := range strings.Split(*highlightFields, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			rv = append(rv, field)
+		}
+	}
+	return rv
+}
+
+// defaultHighlight returns the highlight applied to searches that do not
+// request one: the -highlightFields when -highlightByDefault is set, nil
+// otherwise
+func defaultHighlight() *bleve.HighlightRequest {
+	if !*highlightByDefault {
+		return nil
+	}
+	return newFieldsHighlight()
+}
+
+// newFieldsHighlight returns a highlight of the -highlightFields
+func newFieldsHighlight() *bleve.HighlightRequest {
+	highlight := bleve.NewHighlight()
+	highlight.Fields = highlightFieldList()
+	return highlight
+}
+
+// sortableFields are the fields hits can be sorted by, besides bleve's _id
+// and _score. Sorting uses the indexed terms, so only fields holding a
+// single term per document, keywords and numbers, sort meaningfully.
+var sortableFields = map[string]bool{
+	"type":         true,
+	"style":        true,
+	"category":     true,
+	"abv_category": true,
+	breweryIDField: true,
+	"abv":          true,
+	"ibu":          true,
+	"srm":          true,
+	seqField:       true,
+}
+
+// parseSortOrder parses a comma separated list of fields, each optionally
+// prefixed with - for descending order, into a bleve sort order
+func parseSortOrder(s string) ([]string, error) {
+	var rv []string
+	for _, key := range strings.Split(s, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		field := aliasField(strings.TrimPrefix(key, "-"))
+		if field != "_id" && field != "_score" && !sortableFields[field] {
+			return nil, fmt.Errorf("field '%s' is not sortable", field)
+		}
+		if desc {
+			field = "-" + field
+		}
+		rv = append(rv, field)
+	}
+	return rv, nil
+}
+
+// isShortQuery reports whether q has fewer characters than -minQueryLength,
+// ignoring surrounding space
+func isShortQuery(q string) bool {
+	return *minQueryLength > 0 && utf8.RuneCountInString(strings.TrimSpace(q)) < *minQueryLength
+}
+
+// buildMatchQuery returns a match query for q, restricted to field, or the
+// field it is an alias for, if set
+func buildMatchQuery(q, field string) *query.MatchQuery {
+	matchQuery := bleve.NewMatchQuery(q)
+	if field != "" {
+		matchQuery.SetField(aliasField(field))
+	}
+	return matchQuery
+}
+
+// buildExactCaseQuery matches q against beer names, ranking names using the
+// same case as q above those that only match once lowercased
+func buildExactCaseQuery(q string, boost float64) query.Query {
+	exactCaseQuery := buildMatchQuery(q, exactCaseNameField)
+	exactCaseQuery.SetBoost(boost)
+	return bleve.NewDisjunctionQuery(buildMatchQuery(q, "name"), exactCaseQuery)
+}
+
+// buildFuzzyQuery returns a match query for q tolerating up to fuzziness
+// edits per term, outside the first prefix characters of each term. A longer
+// prefix rules out more matches and leaves fewer terms to compare.
+func buildFuzzyQuery(q, field string, fuzziness, prefix int) *query.MatchQuery {
+	matchQuery := buildMatchQuery(q, field)
+	matchQuery.SetFuzziness(fuzziness)
+	matchQuery.SetPrefix(prefix)
+	return matchQuery
+}
+
+// windowSearch runs searchRequest over the top window hits using execute,
+// passes them through process and returns the requested page of what
+// remains. The stored fields named in the request are loaded for process to
+// use.
+func windowSearch(execute func(*bleve.SearchRequest) (*bleve.SearchResult, error),
+	searchRequest *bleve.SearchRequest, window int,
+	process func(search.DocumentMatchCollection) search.DocumentMatchCollection) (*bleve.SearchResult, error) {
+	size, from := searchRequest.Size, searchRequest.From
+	if size < 0 {
+		size = 0
+	}
+	if from < 0 {
+		from = 0
+	}
+	if window < from+size {
+		window = from + size
+	}
+	windowRequest := *searchRequest
+	windowRequest.Size = window
+	windowRequest.From = 0
+	searchResult, err := execute(&windowRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := process(searchResult.Hits)
+	searchResult.MaxScore = 0
+	for _, hit := range hits {
+		if hit.Score > searchResult.MaxScore {
+			searchResult.MaxScore = hit.Score
+		}
+	}
+	if from > len(hits) {
+		from = len(hits)
+	}
+	end := from + size
+	if end > len(hits) {
+		end = len(hits)
+	}
+	searchResult.Hits = hits[from:end]
+	searchResult.Request.Size = size
+	searchResult.Request.From = from
+	return searchResult, nil
+}
+
+// dedupHitsByName drops hits whose lowercased, trimmed name was already seen
+// on an earlier, and so higher scoring, hit
+func dedupHitsByName(hits search.DocumentMatchCollection) search.DocumentMatchCollection {
+	seen := make(map[string]bool)
+	rv := hits[:0]
+	for _, hit := range hits {
+		if name, ok := hit.Fields["name"].(string); ok {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+		}
+		rv = append(rv, hit)
+	}
+	return rv
+}
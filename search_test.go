@@ -0,0 +1,429 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+var searchTestDocs = map[string]interface{}{
+	"guinness": map[string]interface{}{
+		"type":        "beer",
+		"name":        "Guinness Draught",
+		"description": "A creamy irish stout",
+	},
+	"smithwicks": map[string]interface{}{
+		"type":        "beer",
+		"name":        "Smithwick's",
+		"description": "A red irish ale",
+	},
+}
+
+// serveTestSearch issues a GET wrapper search against the named index
+func serveTestSearch(t *testing.T, indexName, rawQuery string) (int, map[string]interface{}) {
+	req, err := http.NewRequest("GET", "/api/search?"+rawQuery, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newSearchQueryHandler(indexName).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		return rr.Code, nil
+	}
+	var rv map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &rv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, rv
+}
+
+func TestSearchFuzzyFallback(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	// without the fallback the typo finds nothing
+	_, result := serveTestSearch(t, "searchTest", "q=draugt")
+	if result["strategy"] != strategyExact {
+		t.Errorf("expected strategy %s, got %v", strategyExact, result["strategy"])
+	}
+	if result["total_hits"].(float64) != 0 {
+		t.Errorf("expected 0 hits, got %v", result["total_hits"])
+	}
+
+	// with it, the fuzzy search finds the intended beer
+	_, result = serveTestSearch(t, "searchTest", "q=draugt&fuzzyFallback=1")
+	if result["strategy"] != strategyFuzzy {
+		t.Errorf("expected strategy %s, got %v", strategyFuzzy, result["strategy"])
+	}
+	hits := result["hits"].([]interface{})
+	if len(hits) != 1 || hits[0].(map[string]interface{})["id"] != "guinness" {
+		t.Errorf("expected fuzzy hit guinness, got %v", hits)
+	}
+
+	// a correctly spelled query does not escalate
+	_, result = serveTestSearch(t, "searchTest", "q=guinness&fuzzyFallback=1")
+	if result["strategy"] != strategyExact {
+		t.Errorf("expected strategy %s, got %v", strategyExact, result["strategy"])
+	}
+}
+
+func TestSearchFuzzyPrefix(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	// a typo in the first character is one edit from draught
+	_, result := serveTestSearch(t, "searchTest", "q=traught&fuzzyFallback=1")
+	hits := result["hits"].([]interface{})
+	if len(hits) != 1 || hits[0].(map[string]interface{})["id"] != "guinness" {
+		t.Errorf("expected fuzzy hit guinness, got %v", hits)
+	}
+
+	// but requiring the first character to match rules it out
+	_, result = serveTestSearch(t, "searchTest", "q=traught&fuzzyFallback=1&fuzzyPrefix=1")
+	if hits := result["hits"].([]interface{}); len(hits) != 0 {
+		t.Errorf("expected no hits with fuzzyPrefix=1, got %v", hits)
+	}
+
+	// typos after the prefix still match
+	_, result = serveTestSearch(t, "searchTest", "q=draugt&fuzzyFallback=1&fuzzyPrefix=3")
+	hits = result["hits"].([]interface{})
+	if len(hits) != 1 || hits[0].(map[string]interface{})["id"] != "guinness" {
+		t.Errorf("expected fuzzy hit guinness with fuzzyPrefix=3, got %v", hits)
+	}
+
+	if code, _ := serveTestSearch(t, "searchTest", "q=traught&fuzzyPrefix=x"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a bad fuzzyPrefix, got %d", code)
+	}
+}
+
+func TestSearchMinQueryLength(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+	defer func(orig int) { *minQueryLength = orig }(*minQueryLength)
+	defer func(orig string) { *shortQueryPolicy = orig }(*shortQueryPolicy)
+	*minQueryLength = 3
+
+	*shortQueryPolicy = "reject"
+	if code, _ := serveTestSearch(t, "searchTest", "q=a"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a short query, got %d", code)
+	}
+	// surrounding space does not count towards the length
+	if code, _ := serveTestSearch(t, "searchTest", "q=+ab+"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a padded short query, got %d", code)
+	}
+	_, result := serveTestSearch(t, "searchTest", "q=ale")
+	if result["total_hits"].(float64) != 1 {
+		t.Errorf("expected a query of the minimum length to run, got %v", result["total_hits"])
+	}
+
+	*shortQueryPolicy = "empty"
+	code, result := serveTestSearch(t, "searchTest", "q=a&fuzzyFallback=1")
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200 for a short query, got %d", code)
+	}
+	if result["total_hits"].(float64) != 0 || result["strategy"] != strategyExact {
+		t.Errorf("expected no hits and no fuzzy fallback, got %v", result)
+	}
+}
+
+func TestSearchSort(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"stout-light":  map[string]interface{}{"type": "beer", "name": "Light Stout", "style": "Stout", "abv": 4.2},
+		"stout-strong": map[string]interface{}{"type": "beer", "name": "Strong Stout", "style": "Stout", "abv": 9.0},
+		"ale-light":    map[string]interface{}{"type": "beer", "name": "Light Ale", "style": "Ale", "abv": 3.8},
+		"ale-strong":   map[string]interface{}{"type": "beer", "name": "Strong Ale", "style": "Ale", "abv": 7.5},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	hitIDs := func(result map[string]interface{}) []string {
+		ids := []string{}
+		for _, hit := range result["hits"].([]interface{}) {
+			ids = append(ids, hit.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+
+	_, result := serveTestSearch(t, "searchTest", "q=light+strong&sort=style,-abv")
+	expect := []string{"ale-strong", "ale-light", "stout-strong", "stout-light"}
+	if ids := hitIDs(result); !reflect.DeepEqual(ids, expect) {
+		t.Errorf("expected %v, got %v", expect, ids)
+	}
+	_, result = serveTestSearch(t, "searchTest", "q=light+strong&sort=-style,abv")
+	expect = []string{"stout-light", "stout-strong", "ale-light", "ale-strong"}
+	if ids := hitIDs(result); !reflect.DeepEqual(ids, expect) {
+		t.Errorf("expected %v, got %v", expect, ids)
+	}
+
+	for _, sort := range []string{"name", "style,", "abv&rescore=_score"} {
+		if code, _ := serveTestSearch(t, "searchTest", "q=light&sort="+sort); code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for sort=%s, got %d", sort, code)
+		}
+	}
+}
+
+func TestSearchMissingQuery(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	code, _ := serveTestSearch(t, "searchTest", "")
+	if code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", code)
+	}
+}
+
+func TestSearchDedupByName(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"source1-pale": map[string]interface{}{
+			"type":        "beer",
+			"name":        "Pale Ale",
+			"description": "pale and hoppy",
+		},
+		"source2-pale": map[string]interface{}{
+			"type": "beer",
+			"name": " pale ALE ",
+		},
+		"pale-lager": map[string]interface{}{
+			"type": "beer",
+			"name": "Pale Lager",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	hitIDs := func(result map[string]interface{}) []string {
+		var rv []string
+		for _, hit := range result["hits"].([]interface{}) {
+			rv = append(rv, hit.(map[string]interface{})["id"].(string))
+		}
+		return rv
+	}
+
+	_, result := serveTestSearch(t, "searchTest", "q=pale")
+	if ids := hitIDs(result); len(ids) != 3 {
+		t.Fatalf("expected 3 hits without dedup, got %v", ids)
+	}
+
+	_, result = serveTestSearch(t, "searchTest", "q=pale&dedupByName=1")
+	ids := hitIDs(result)
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 hits with dedup, got %v", ids)
+	}
+	if ids[0] != "source1-pale" {
+		t.Errorf("expected the higher scoring duplicate source1-pale first, got %v", ids)
+	}
+	for _, id := range ids {
+		if id == "source2-pale" {
+			t.Errorf("expected source2-pale to be collapsed, got %v", ids)
+		}
+	}
+
+	// negative paging is rejected before any post-processing runs
+	for _, params := range []string{"size=-5", "from=-5", "window=-1"} {
+		if code, _ := serveTestSearch(t, "searchTest", "q=pale&dedupByName=1&"+params); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", params, code)
+		}
+	}
+}
+
+func TestSearchNegativeSizeFrom(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	for _, params := range []string{"size=-5", "from=-1"} {
+		if code, _ := serveTestSearch(t, "searchTest", "q=irish&"+params); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", params, code)
+		}
+	}
+}
+
+// searchRecordingIndex records the search requests it executes
+type searchRecordingIndex struct {
+	wrappedIndex
+	requests []*bleve.SearchRequest
+}
+
+func (i *searchRecordingIndex) SearchInContext(ctx context.Context, req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	i.requests = append(i.requests, req)
+	return i.wrappedIndex.SearchInContext(ctx, req)
+}
+
+func TestSearchIDsOnly(t *testing.T) {
+	defer func(orig bool) { *highlightByDefault = orig }(*highlightByDefault)
+	*highlightByDefault = true
+
+	index := &searchRecordingIndex{wrappedIndex: newTestIndex(t, searchTestDocs)}
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	_, result := serveTestSearch(t, "searchTest", "q=irish&idsOnly=1&size=1")
+	if result["total_hits"].(float64) != 2 {
+		t.Errorf("expected 2 total hits, got %v", result["total_hits"])
+	}
+	ids, ok := result["ids"].([]interface{})
+	if !ok || len(ids) != 1 {
+		t.Fatalf("expected 1 id, got %v", result["ids"])
+	}
+	if _, ok := searchTestDocs[ids[0].(string)]; !ok {
+		t.Errorf("unexpected id %v", ids[0])
+	}
+	for _, key := range []string{"hits", "fields", "request"} {
+		if _, ok := result[key]; ok {
+			t.Errorf("expected no %s in ids only response, got %v", key, result[key])
+		}
+	}
+	for _, searchRequest := range index.requests {
+		if searchRequest.Highlight != nil || len(searchRequest.Fields) != 0 {
+			t.Errorf("expected no highlight or fields, got %v and %v", searchRequest.Highlight, searchRequest.Fields)
+		}
+	}
+
+	// only the fields post-processing reads are loaded
+	index.requests = nil
+	_, result = serveTestSearch(t, "searchTest", "q=irish&idsOnly=1&dedupByName=1&highlight=1")
+	if len(index.requests) != 1 {
+		t.Fatalf("expected 1 search, got %d", len(index.requests))
+	}
+	searchRequest := index.requests[0]
+	if searchRequest.Highlight != nil {
+		t.Errorf("expected no highlight, got %v", searchRequest.Highlight)
+	}
+	if !reflect.DeepEqual(searchRequest.Fields, []string{"name"}) {
+		t.Errorf("expected only the name field, got %v", searchRequest.Fields)
+	}
+}
+
+func TestSearchExactCase(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"brand": map[string]interface{}{
+			"type": "beer",
+			"name": "Guinness Draught",
+		},
+		"shouty": map[string]interface{}{
+			"type": "beer",
+			"name": "GUINNESS DRAUGHT",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("searchTest", index)
+	defer bleveHttp.UnregisterIndexByName("searchTest")
+
+	_, result := serveTestSearch(t, "searchTest", "q=Guinness&exactCase=1")
+	hits := result["hits"].([]interface{})
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %v", hits)
+	}
+	first := hits[0].(map[string]interface{})
+	second := hits[1].(map[string]interface{})
+	if first["id"] != "brand" {
+		t.Errorf("expected exact-case brand to rank first, got %v", first["id"])
+	}
+	if first["score"].(float64) <= second["score"].(float64) {
+		t.Errorf("expected exact-case score %v to exceed %v", first["score"], second["score"])
+	}
+
+	// the other casing wins when that is what was asked for
+	_, result = serveTestSearch(t, "searchTest", "q=GUINNESS&exactCase=1&exactCaseBoost=5")
+	hits = result["hits"].([]interface{})
+	if len(hits) != 2 || hits[0].(map[string]interface{})["id"] != "shouty" {
+		t.Errorf("expected shouty to rank first, got %v", hits)
+	}
+}
+
+func TestSearchHighlightByDefault(t *testing.T) {
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("highlightTest", index)
+	defer bleveHttp.UnregisterIndexByName("highlightTest")
+	defer func(orig bool) { *highlightByDefault = orig }(*highlightByDefault)
+
+	fragments := func(result map[string]interface{}) map[string]interface{} {
+		hits := result["hits"].([]interface{})
+		if len(hits) != 1 {
+			t.Fatalf("expected 1 hit, got %v", hits)
+		}
+		f, _ := hits[0].(map[string]interface{})["fragments"].(map[string]interface{})
+		return f
+	}
+
+	*highlightByDefault = false
+	_, result := serveTestSearch(t, "highlightTest", "q=stout")
+	if f := fragments(result); len(f) != 0 {
+		t.Errorf("expected no fragments by default, got %v", f)
+	}
+
+	*highlightByDefault = true
+	_, result = serveTestSearch(t, "highlightTest", "q=stout")
+	f := fragments(result)
+	description, _ := f["description"].([]interface{})
+	if len(description) != 1 || !strings.Contains(description[0].(string), "<mark>stout</mark>") {
+		t.Errorf("expected a highlighted description fragment, got %v", f)
+	}
+
+	// requests can still opt out
+	_, result = serveTestSearch(t, "highlightTest", "q=stout&highlight=false")
+	if f := fragments(result); len(f) != 0 {
+		t.Errorf("expected no fragments with highlight=false, got %v", f)
+	}
+
+	// and POST requests specifying their own highlight keep it
+	body := `{"query": {"match": "stout"}, "highlight": {"fields": ["name"]}}`
+	req, err := http.NewRequest("POST", "/api/search", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newSearchRequestHandler("highlightTest").ServeHTTP(rr, req)
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := fragments(result); f["description"] != nil || f["name"] == nil {
+		t.Errorf("expected only name fragments, got %v", f)
+	}
+	body = `{"query": {"match": "stout"}}`
+	req, err = http.NewRequest("POST", "/api/search", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	newSearchRequestHandler("highlightTest").ServeHTTP(rr, req)
+	result = nil
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := fragments(result); len(f["description"].([]interface{})) != 1 {
+		t.Errorf("expected the default highlight on a POST search, got %v", f)
+	}
+}
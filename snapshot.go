@@ -0,0 +1,132 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// compareSnapshotHandler serves GET /api/compare_snapshot?q=&snapshot=,
+// running a match query for q, optionally restricted to field, against
+// both the live index and the named snapshot, a copy of an index kept in a
+// subdirectory of -snapshotDir, such as a backup taken before a mapping
+// change. It responds with the top size hits, 10 by default, of each, the
+// documents only one of them returned and the Jaccard similarity of the
+// two. Snapshots are opened read-only for the duration of the request.
+type compareSnapshotHandler struct {
+	defaultIndexName string
+}
+
+func newCompareSnapshotHandler(defaultIndexName string) *compareSnapshotHandler {
+	return &compareSnapshotHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *compareSnapshotHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	q := req.FormValue("q")
+	if q == "" {
+		showError(w, req, "missing required parameter 'q'", 400)
+		return
+	}
+	if *snapshotDir == "" {
+		showError(w, req, "no -snapshotDir configured", 404)
+		return
+	}
+	name := req.FormValue("snapshot")
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		showError(w, req, fmt.Sprintf("invalid snapshot name '%s'", name), 400)
+		return
+	}
+	size, err := intParam(req, "size", 10)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+
+	path := filepath.Join(*snapshotDir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		showError(w, req, fmt.Sprintf("no such snapshot '%s'", name), 404)
+		return
+	}
+	snapshot, err := bleve.OpenUsing(path, map[string]interface{}{
+		"read_only": true,
+	})
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error opening snapshot '%s': %v", name, err), 500)
+		return
+	}
+	defer snapshot.Close()
+
+	searchRequest := bleve.NewSearchRequestOptions(buildMatchQuery(q, req.FormValue("field")), size, 0, false)
+	live, err := compareRun(index, searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query: %v", err), 500)
+		return
+	}
+	snapshotted, err := compareRun(snapshot, searchRequest)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error executing query against snapshot '%s': %v", name, err), 500)
+		return
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"live":          live,
+		"snapshot":      snapshotted,
+		"only_live":     idsMissingFrom(live.IDs, snapshotted.IDs),
+		"only_snapshot": idsMissingFrom(snapshotted.IDs, live.IDs),
+		"jaccard":       jaccard(live.IDs, snapshotted.IDs),
+	})
+}
+
+// compareRun runs searchRequest against index, returning the ranked IDs
+func compareRun(index bleve.Index, searchRequest *bleve.SearchRequest) (comparedResult, error) {
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		return comparedResult{}, err
+	}
+	ids := make([]string, len(searchResult.Hits))
+	for i, hit := range searchResult.Hits {
+		ids[i] = hit.ID
+	}
+	return comparedResult{
+		Total: searchResult.Total,
+		IDs:   ids,
+	}, nil
+}
+
+// idsMissingFrom returns the IDs of a not in b, in the order of a
+func idsMissingFrom(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, id := range b {
+		set[id] = true
+	}
+	rv := []string{}
+	for _, id := range a {
+		if !set[id] {
+			rv = append(rv, id)
+		}
+	}
+	return rv
+}
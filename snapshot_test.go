@@ -0,0 +1,104 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestCompareSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beer-search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(orig string) { *snapshotDir = orig }(*snapshotDir)
+	*snapshotDir = dir
+
+	// the snapshot predates the red ale
+	indexMapping, err := buildIndexMapping(bleve.Config.DefaultIndexType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := bleve.New(filepath.Join(dir, "before"), indexMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snapshot.Index("guinness", searchTestDocs["guinness"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snapshot.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := newTestIndex(t, searchTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("compareSnapshotTest", index)
+	defer bleveHttp.UnregisterIndexByName("compareSnapshotTest")
+
+	serve := func(rawQuery string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/compare_snapshot?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		newCompareSnapshotHandler("compareSnapshotTest").ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("q=irish&snapshot=before")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result struct {
+		Live         comparedResult `json:"live"`
+		Snapshot     comparedResult `json:"snapshot"`
+		OnlyLive     []string       `json:"only_live"`
+		OnlySnapshot []string       `json:"only_snapshot"`
+		Jaccard      float64        `json:"jaccard"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Live.Total != 2 || result.Snapshot.Total != 1 {
+		t.Errorf("expected 2 live hits and 1 in the snapshot, got %d and %d", result.Live.Total, result.Snapshot.Total)
+	}
+	if !reflect.DeepEqual(result.OnlyLive, []string{"smithwicks"}) || len(result.OnlySnapshot) != 0 {
+		t.Errorf("expected only smithwicks to differ, got %v and %v", result.OnlyLive, result.OnlySnapshot)
+	}
+	if result.Jaccard != 0.5 {
+		t.Errorf("expected jaccard 0.5, got %v", result.Jaccard)
+	}
+
+	for rawQuery, code := range map[string]int{
+		"q=irish&snapshot=missing":        http.StatusNotFound,
+		"q=irish&snapshot=../other":       http.StatusBadRequest,
+		"q=irish":                         http.StatusBadRequest,
+		"snapshot=before":                 http.StatusBadRequest,
+		"q=irish&snapshot=before&size=-1": http.StatusBadRequest,
+	} {
+		if rr := serve(rawQuery); rr.Code != code {
+			t.Errorf("expected status %d for %s, got %d", code, rawQuery, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+const (
+	// sourceField holds the original bytes of a document when -storeSource
+	// is set, sourceTypeField their content type
+	sourceField     = "_source"
+	sourceTypeField = "_source_type"
+)
+
+// storeDocumentSource records raw, the bytes jsonDoc was parsed from, in
+// the document's source fields so they can be served verbatim
+func storeDocumentSource(jsonDoc interface{}, raw []byte, contentType string) {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok {
+		return
+	}
+	doc[sourceField] = string(raw)
+	doc[sourceTypeField] = contentType
+}
+
+// sourceHandler serves GET /api/source/{docID}, responding with the exact
+// bytes the document was indexed from and their original content type.
+// Only documents indexed with -storeSource have a source.
+type sourceHandler struct {
+	defaultIndexName string
+	DocIDLookup      func(req *http.Request) string
+}
+
+func newSourceHandler(defaultIndexName string) *sourceHandler {
+	return &sourceHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *sourceHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	// find the doc id
+	var docID string
+	if h.DocIDLookup != nil {
+		docID = h.DocIDLookup(req)
+	}
+	if docID == "" {
+		showError(w, req, "document id cannot be empty", 400)
+		return
+	}
+
+	doc, err := index.Document(docID)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error looking up document '%s': %v", docID, err), 500)
+		return
+	}
+	if doc == nil {
+		showError(w, req, fmt.Sprintf("no such document '%s'", docID), 404)
+		return
+	}
+
+	var source []byte
+	contentType := "application/json"
+	for _, field := range doc.Fields {
+		switch field.Name() {
+		case sourceField:
+			source = field.Value()
+		case sourceTypeField:
+			if value := field.Value(); len(value) > 0 {
+				contentType = string(value)
+			}
+		}
+	}
+	if source == nil {
+		showError(w, req, fmt.Sprintf("no source stored for document '%s'", docID), 404)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(source)
+}
@@ -0,0 +1,92 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestSource(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	defer func(orig bool) { *storeSource = orig }(*storeSource)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"odd.json": "{\n   \"type\" : \"beer\",\"name\":\"Caf\\u00e9 Ale\",\n\t\"abv\": 5.00 }\n",
+	})
+	defer os.RemoveAll(*jsonDir)
+	original, err := ioutil.ReadFile(filepath.Join(*jsonDir, "odd.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*storeSource = true
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err = indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bleveHttp.RegisterIndexName("sourceTest", index)
+	defer bleveHttp.UnregisterIndexByName("sourceTest")
+
+	serve := func(docID string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/source/"+docID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := newSourceHandler("sourceTest")
+		handler.DocIDLookup = func(*http.Request) string { return docID }
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("odd")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !bytes.Equal(rr.Body.Bytes(), original) {
+		t.Errorf("expected source %q, got %q", original, rr.Body.Bytes())
+	}
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("expected a JSON content type, got %s", contentType)
+	}
+
+	// the source is stored, not searchable
+	_, result := serveTestSearch(t, "sourceTest", "q=00e9")
+	if result["total_hits"].(float64) != 0 {
+		t.Errorf("expected the source not to be indexed, got %v", result["total_hits"])
+	}
+
+	// documents indexed without -storeSource have no source
+	*storeSource = false
+	batch := index.NewBatch()
+	err = batch.Index("plain", map[string]interface{}{"type": "beer", "name": "Plain"})
+	if err == nil {
+		err = index.Batch(batch)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve("plain"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 without a stored source, got %d", rr.Code)
+	}
+	if rr := serve("missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for missing document, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,239 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+// suggestField is the stored field suggestions are read from
+const suggestField = "name"
+
+// suggestPageSize is the number of documents read per page while loading
+// suggestions
+var suggestPageSize = 1000
+
+// suggestions holds the names suggested by /api/suggest
+var suggestions = &suggestDictionary{}
+
+// suggestEntry is a suggestable name, keyed by its folded form
+type suggestEntry struct {
+	key  string
+	text string
+}
+
+// suggestion is a name matching a prefix, highlighted holds the name as
+// HTML with the matched prefix wrapped in <mark>
+type suggestion struct {
+	Text        string `json:"text"`
+	Highlighted string `json:"highlighted"`
+}
+
+// suggestDictionary is the sorted set of distinct names in the index,
+// searched by case-insensitive prefix. It is loaded from the index on first
+// use, and only reloaded by /api/admin/rebuild_suggest.
+type suggestDictionary struct {
+	mu      sync.RWMutex
+	loaded  bool
+	entries []suggestEntry
+}
+
+// foldCase lower cases s a rune at a time, so a folded string has as many
+// runes as the original and a folded prefix ends at the same rune
+func foldCase(s string) string {
+	return strings.Map(unicode.ToLower, s)
+}
+
+// ensureLoaded loads the dictionary from index unless it already has been
+func (d *suggestDictionary) ensureLoaded(index bleve.Index) error {
+	d.mu.RLock()
+	loaded := d.loaded
+	d.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	_, err := d.load(index)
+	return err
+}
+
+// load replaces the dictionary with the names stored in index, returning
+// the number of distinct names loaded
+func (d *suggestDictionary) load(index bleve.Index) (int, error) {
+	names := make(map[string]bool)
+	var after []string
+	for {
+		searchRequest := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), suggestPageSize, 0, false)
+		searchRequest.SortBy([]string{"_id"})
+		searchRequest.SearchAfter = after
+		searchRequest.Fields = []string{suggestField}
+		searchResult, err := index.Search(searchRequest)
+		if err != nil {
+			return 0, err
+		}
+		for _, hit := range searchResult.Hits {
+			switch name := hit.Fields[suggestField].(type) {
+			case string:
+				names[name] = true
+			case []interface{}:
+				for _, value := range name {
+					if value, ok := value.(string); ok {
+						names[value] = true
+					}
+				}
+			}
+		}
+		if len(searchResult.Hits) < suggestPageSize {
+			break
+		}
+		after = []string{searchResult.Hits[len(searchResult.Hits)-1].ID}
+	}
+
+	entries := make([]suggestEntry, 0, len(names))
+	for name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		entries = append(entries, suggestEntry{
+			key:  foldCase(name),
+			text: name,
+		})
+	}
+	sort.Sort(suggestEntriesByKey(entries))
+
+	d.mu.Lock()
+	d.entries = entries
+	d.loaded = true
+	d.mu.Unlock()
+	return len(entries), nil
+}
+
+// suggest returns up to n names starting with prefix, ignoring case, in
+// alphabetical order
+func (d *suggestDictionary) suggest(prefix string, n int) []suggestion {
+	key := foldCase(prefix)
+	matchedRunes := len([]rune(key))
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	rv := []suggestion{}
+	i := sort.Search(len(d.entries), func(i int) bool {
+		return d.entries[i].key >= key
+	})
+	for ; i < len(d.entries) && len(rv) < n; i++ {
+		entry := d.entries[i]
+		if !strings.HasPrefix(entry.key, key) {
+			break
+		}
+		textRunes := []rune(entry.text)
+		rv = append(rv, suggestion{
+			Text: entry.text,
+			Highlighted: "<mark>" + html.EscapeString(string(textRunes[:matchedRunes])) + "</mark>" +
+				html.EscapeString(string(textRunes[matchedRunes:])),
+		})
+	}
+	return rv
+}
+
+type suggestEntriesByKey []suggestEntry
+
+func (s suggestEntriesByKey) Len() int      { return len(s) }
+func (s suggestEntriesByKey) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s suggestEntriesByKey) Less(i, j int) bool {
+	if s[i].key != s[j].key {
+		return s[i].key < s[j].key
+	}
+	return s[i].text < s[j].text
+}
+
+// suggestHandler serves GET /api/suggest?prefix=&size=, returning up to size
+// names of beers and breweries starting with prefix, ignoring case, for
+// autocompletion. Each keeps its original casing, and comes with an HTML
+// form marking the part matched. size defaults to 10.
+type suggestHandler struct {
+	defaultIndexName string
+}
+
+func newSuggestHandler(defaultIndexName string) *suggestHandler {
+	return &suggestHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *suggestHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	prefix := req.FormValue("prefix")
+	if prefix == "" {
+		showError(w, req, "missing required parameter 'prefix'", 400)
+		return
+	}
+	size, err := intParam(req, "size", 10)
+	if err != nil || size < 0 {
+		showError(w, req, fmt.Sprintf("invalid size '%s'", req.FormValue("size")), 400)
+		return
+	}
+
+	err = suggestions.ensureLoaded(index)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error loading suggestions: %v", err), 500)
+		return
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"suggestions": suggestions.suggest(prefix, size),
+	})
+}
+
+// rebuildSuggestHandler serves POST /api/admin/rebuild_suggest, reloading
+// the suggestions from the current contents of the index, so names indexed
+// or changed since they were loaded are suggested without a reindex. It
+// reports the number of distinct names loaded.
+type rebuildSuggestHandler struct {
+	defaultIndexName string
+}
+
+func newRebuildSuggestHandler(defaultIndexName string) *rebuildSuggestHandler {
+	return &rebuildSuggestHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *rebuildSuggestHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	index := bleveHttp.IndexByName(h.defaultIndexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	terms, err := suggestions.load(index)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error loading suggestions: %v", err), 500)
+		return
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"terms": terms,
+	})
+}
@@ -0,0 +1,183 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+var suggestTestDocs = map[string]interface{}{
+	"guinness": map[string]interface{}{
+		"type": "beer",
+		"name": "Guinness Draught",
+	},
+	"guinness_extra": map[string]interface{}{
+		"type": "beer",
+		"name": "GUINNESS Extra Stout",
+	},
+	"gulden": map[string]interface{}{
+		"type": "beer",
+		"name": "Gulden Draak",
+	},
+	"ueber": map[string]interface{}{
+		"type": "beer",
+		"name": "Über Pils & Co",
+	},
+	"smithwicks": map[string]interface{}{
+		"type": "beer",
+		"name": "Smithwicks",
+	},
+}
+
+// serveTestSuggest requests suggestions for rawQuery, returning nil for
+// responses other than a 200
+func serveTestSuggest(t *testing.T, indexName, rawQuery string) (int, []suggestion) {
+	req, err := http.NewRequest("GET", "/api/suggest?"+rawQuery, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newSuggestHandler(indexName).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		return rr.Code, nil
+	}
+	var rv struct {
+		Suggestions []suggestion `json:"suggestions"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &rv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, rv.Suggestions
+}
+
+func TestSuggest(t *testing.T) {
+	defer func(orig *suggestDictionary) {
+		suggestions = orig
+	}(suggestions)
+	suggestions = &suggestDictionary{}
+
+	index := newTestIndex(t, suggestTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("suggestTest", index)
+	defer bleveHttp.UnregisterIndexByName("suggestTest")
+
+	tests := []struct {
+		rawQuery string
+		expect   []suggestion
+	}{
+		{
+			rawQuery: "prefix=guin",
+			expect: []suggestion{
+				{Text: "Guinness Draught", Highlighted: "<mark>Guin</mark>ness Draught"},
+				{Text: "GUINNESS Extra Stout", Highlighted: "<mark>GUIN</mark>NESS Extra Stout"},
+			},
+		},
+		{
+			rawQuery: "prefix=GU&size=2",
+			expect: []suggestion{
+				{Text: "Guinness Draught", Highlighted: "<mark>Gu</mark>inness Draught"},
+				{Text: "GUINNESS Extra Stout", Highlighted: "<mark>GU</mark>INNESS Extra Stout"},
+			},
+		},
+		{
+			// the prefix is matched by character, not byte, and the
+			// markup is escaped
+			rawQuery: "prefix=%C3%BCber",
+			expect: []suggestion{
+				{Text: "Über Pils & Co", Highlighted: "<mark>Über</mark> Pils &amp; Co"},
+			},
+		},
+		{
+			rawQuery: "prefix=stout",
+			expect:   []suggestion{},
+		},
+	}
+	for _, test := range tests {
+		code, result := serveTestSuggest(t, "suggestTest", test.rawQuery)
+		if code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", test.rawQuery, code)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.expect) {
+			t.Errorf("%s: expected %v, got %v", test.rawQuery, test.expect, result)
+		}
+	}
+
+	if code, _ := serveTestSuggest(t, "suggestTest", "prefix="); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a prefix, got %d", code)
+	}
+}
+
+func TestRebuildSuggest(t *testing.T) {
+	defer func(orig *suggestDictionary) {
+		suggestions = orig
+	}(suggestions)
+	suggestions = &suggestDictionary{}
+
+	index := newTestIndex(t, suggestTestDocs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("rebuildSuggestTest", index)
+	defer bleveHttp.UnregisterIndexByName("rebuildSuggestTest")
+
+	_, result := serveTestSuggest(t, "rebuildSuggestTest", "prefix=gu")
+	if len(result) != 3 {
+		t.Fatalf("expected 3 suggestions, got %v", result)
+	}
+
+	// suggestions go stale as the index changes
+	err := index.Index("gulpener", map[string]interface{}{
+		"type": "beer",
+		"name": "Gulpener Korenwolf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = index.Delete("gulden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, result = serveTestSuggest(t, "rebuildSuggestTest", "prefix=gul")
+	if len(result) != 1 || result[0].Text != "Gulden Draak" {
+		t.Errorf("expected the stale suggestion Gulden Draak, got %v", result)
+	}
+
+	req, err := http.NewRequest("POST", "/api/admin/rebuild_suggest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newRebuildSuggestHandler("rebuildSuggestTest").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var rebuilt map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &rebuilt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt["terms"] != 5.0 {
+		t.Errorf("expected 5 terms loaded, got %v", rebuilt["terms"])
+	}
+
+	_, result = serveTestSuggest(t, "rebuildSuggestTest", "prefix=gul")
+	expect := []suggestion{
+		{Text: "Gulpener Korenwolf", Highlighted: "<mark>Gul</mark>pener Korenwolf"},
+	}
+	if !reflect.DeepEqual(result, expect) {
+		t.Errorf("expected %v after rebuilding, got %v", expect, result)
+	}
+}
@@ -0,0 +1,185 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// Synonyms are read from the file named by -synonyms, one group of
+// equivalent terms or phrases per line, separated by commas:
+//
+//	ipa, india pale ale
+//	stout, porter
+//
+// Blank lines and lines starting with '#' are ignored.
+//
+// Synonyms are applied at index time: when a document's name or description
+// mentions a member of a group, the other members are added to its
+// synonyms field, which is part of _all. This keeps queries cheap and
+// works with every query type, but only for searches over _all, and an
+// edited file only affects documents indexed after it is reloaded, so
+// existing documents need a reindex. Expanding the query instead would take
+// effect immediately without a reindex, at the cost of larger queries and
+// only for the query builders that perform the expansion.
+
+const synonymsField = "synonyms"
+
+// synonymSourceFields are the fields scanned for synonym expansion
+var synonymSourceFields = []string{"name", "description"}
+
+type synonymSet struct {
+	m      sync.RWMutex
+	groups [][]string
+}
+
+var synonyms synonymSet
+
+// load replaces the synonym groups with those read from path, an empty path
+// clears them
+func (s *synonymSet) load(path string) error {
+	var groups [][]string
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			var group []string
+			for _, term := range strings.Split(line, ",") {
+				term = normalizeSynonymText(term)
+				if term != "" {
+					group = append(group, term)
+				}
+			}
+			if len(group) > 1 {
+				groups = append(groups, group)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	s.m.Lock()
+	s.groups = groups
+	s.m.Unlock()
+	return nil
+}
+
+func (s *synonymSet) size() int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return len(s.groups)
+}
+
+// expand adds the synonyms of terms mentioned in the source fields of
+// jsonDoc to its synonyms field
+func (s *synonymSet) expand(jsonDoc interface{}) {
+	doc, ok := jsonDoc.(map[string]interface{})
+	if !ok {
+		return
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if len(s.groups) == 0 {
+		return
+	}
+
+	var text []string
+	for _, field := range synonymSourceFields {
+		if v, ok := doc[field].(string); ok {
+			text = append(text, normalizeSynonymText(v))
+		}
+	}
+	padded := " " + strings.Join(text, " ") + " "
+
+	var expansions []string
+	for _, group := range s.groups {
+		for i, term := range group {
+			if strings.Contains(padded, " "+term+" ") {
+				expansions = append(expansions, group[:i]...)
+				expansions = append(expansions, group[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(expansions) > 0 {
+		doc[synonymsField] = strings.Join(expansions, " ")
+	}
+}
+
+// normalizeSynonymText lowercases s and collapses runs of anything other
+// than letters and digits into single spaces
+func normalizeSynonymText(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// reloadSynonymsHandler serves POST /api/admin/reload_synonyms, rereading
+// the -synonyms file. As synonyms are applied at index time, passing
+// reindex=1 also starts a background reindex so existing documents pick up
+// the change, refused with a 409 while another indexing run is in progress.
+type reloadSynonymsHandler struct {
+	Reindex func() error
+}
+
+func newReloadSynonymsHandler(reindex func() error) *reloadSynonymsHandler {
+	return &reloadSynonymsHandler{
+		Reindex: reindex,
+	}
+}
+
+func (h *reloadSynonymsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reindex := req.FormValue("reindex") != ""
+	if reindex && !atomic.CompareAndSwapInt32(&reindexing, 0, 1) {
+		showError(w, req, "a reindex is already running", 409)
+		return
+	}
+
+	err := synonyms.load(*synonymsPath)
+	if err != nil {
+		if reindex {
+			atomic.StoreInt32(&reindexing, 0)
+		}
+		showError(w, req, fmt.Sprintf("error loading synonyms: %v", err), 500)
+		return
+	}
+
+	if reindex {
+		go func() {
+			defer atomic.StoreInt32(&reindexing, 0)
+			err := h.Reindex()
+			if err != nil {
+				log.Printf("error reindexing after synonym reload: %v", err)
+			}
+		}()
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"groups":     synonyms.size(),
+		"reindexing": reindex,
+	})
+}
@@ -0,0 +1,118 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestReloadSynonyms(t *testing.T) {
+	defer func(orig string) { *jsonDir = orig }(*jsonDir)
+	*jsonDir = writeTestJSONDir(t, map[string]string{
+		"hop.json":   `{"type":"beer","name":"Hop Bomb IPA"}`,
+		"stout.json": `{"type":"beer","name":"Oatmeal Stout"}`,
+	})
+	defer os.RemoveAll(*jsonDir)
+
+	defer func(orig string) { *synonymsPath = orig }(*synonymsPath)
+	*synonymsPath = filepath.Join(*jsonDir, "..", filepath.Base(*jsonDir)+"-synonyms.txt")
+	defer os.Remove(*synonymsPath)
+	writeSynonyms := func(contents string) {
+		err := ioutil.WriteFile(*synonymsPath, []byte(contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer synonyms.load("")
+
+	writeSynonyms("# beer styles\nipa, india pale ale\n")
+	err := synonyms.load(*synonymsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := newTestIndex(t, nil)
+	defer index.Close()
+	err = indexBeer(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectHit := func(q, expectedID string) {
+		searchResult, err := index.Search(bleve.NewSearchRequest(bleve.NewMatchQuery(q)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expectedID == "" {
+			if searchResult.Total != 0 {
+				t.Errorf("expected no hits for '%s', got %v", q, searchResult.Hits)
+			}
+		} else if len(searchResult.Hits) != 1 || searchResult.Hits[0].ID != expectedID {
+			t.Errorf("expected '%s' to find %s, got %v", q, expectedID, searchResult.Hits)
+		}
+	}
+	expectHit("india pale ale", "hop")
+	expectHit("porter", "")
+
+	// add a synonym and reload it, reindexing when asked to
+	writeSynonyms("ipa, india pale ale\nstout, porter\n")
+	reindexed := make(chan error)
+	handler := newReloadSynonymsHandler(func() error {
+		err := indexBeer(index)
+		reindexed <- err
+		return err
+	})
+	req, err := http.NewRequest("POST", "/api/admin/reload_synonyms?reindex=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if synonyms.size() != 2 {
+		t.Errorf("expected 2 synonym groups, got %d", synonyms.size())
+	}
+
+	// the reindex holds the guard until it finishes, a second one is refused
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 while reindexing, got %d", rr.Code)
+	}
+	bleveHttp.RegisterIndexName("synonymsTest", index)
+	defer bleveHttp.UnregisterIndexByName("synonymsTest")
+	rr = httptest.NewRecorder()
+	newReindexHandler("synonymsTest").ServeHTTP(rr, httptest.NewRequest("POST", "/api/reindex", nil))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 from /api/reindex while reindexing, got %d", rr.Code)
+	}
+
+	err = <-reindexed
+	if err != nil {
+		t.Fatal(err)
+	}
+	for atomic.LoadInt32(&reindexing) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	expectHit("porter", "stout")
+	expectHit("india pale ale", "hop")
+}
@@ -0,0 +1,171 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+	"github.com/blevesearch/bleve/index"
+)
+
+// termPosition is one occurrence of a term within a field
+type termPosition struct {
+	Pos            uint64   `json:"pos"`
+	Start          uint64   `json:"start"`
+	End            uint64   `json:"end"`
+	ArrayPositions []uint64 `json:"array_positions,omitempty"`
+}
+
+// termVector describes the occurrences of a term in one field of a document
+type termVector struct {
+	Freq      uint64         `json:"freq"`
+	Positions []termPosition `json:"positions"`
+}
+
+// termVectorsHandler serves GET /api/termvectors/{docID}, returning for each
+// indexed field of the document its terms, their frequencies and positions:
+//
+//	{"id": "...", "fields": {"name": {"stout": {"freq": 1, "positions": [
+//	    {"pos": 2, "start": 8, "end": 13}]}}}}
+//
+// Positions are only available for fields mapped with term vectors, see
+// -highlightFields, other fields report frequencies with empty positions.
+type termVectorsHandler struct {
+	defaultIndexName string
+	DocIDLookup      func(req *http.Request) string
+}
+
+func newTermVectorsHandler(defaultIndexName string) *termVectorsHandler {
+	return &termVectorsHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *termVectorsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	i := bleveHttp.IndexByName(h.defaultIndexName)
+	if i == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", h.defaultIndexName), 404)
+		return
+	}
+
+	// find the doc id
+	var docID string
+	if h.DocIDLookup != nil {
+		docID = h.DocIDLookup(req)
+	}
+	if docID == "" {
+		showError(w, req, "document id cannot be empty", 400)
+		return
+	}
+
+	advanced, _, err := i.Advanced()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error accessing index: %v", err), 500)
+		return
+	}
+	reader, err := advanced.Reader()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error opening index reader: %v", err), 500)
+		return
+	}
+	defer reader.Close()
+
+	doc, err := reader.Document(docID)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error looking up document '%s': %v", docID, err), 500)
+		return
+	}
+	if doc == nil {
+		showError(w, req, fmt.Sprintf("no such document '%s'", docID), 404)
+		return
+	}
+	internalID, err := reader.InternalID(docID)
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error looking up document '%s': %v", docID, err), 500)
+		return
+	}
+
+	fields, err := reader.Fields()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error listing fields: %v", err), 500)
+		return
+	}
+	var indexed []string
+	for _, field := range fields {
+		if field != "_id" {
+			indexed = append(indexed, field)
+		}
+	}
+
+	// collect the terms of the document, then look up each one's postings
+	terms := make(map[string][]string)
+	err = reader.DocumentVisitFieldTerms(internalID, indexed, func(field string, term []byte) {
+		terms[field] = append(terms[field], string(term))
+	})
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error reading terms: %v", err), 500)
+		return
+	}
+
+	rv := make(map[string]map[string]termVector, len(terms))
+	for field, fieldTerms := range terms {
+		vectors := make(map[string]termVector, len(fieldTerms))
+		for _, term := range fieldTerms {
+			vector, err := docTermVector(reader, internalID, field, term)
+			if err != nil {
+				showError(w, req, fmt.Sprintf("error reading term '%s' in field '%s': %v", term, field, err), 500)
+				return
+			}
+			vectors[term] = vector
+		}
+		rv[field] = vectors
+	}
+
+	mustEncode(w, map[string]interface{}{
+		"id":     docID,
+		"fields": rv,
+	})
+}
+
+// docTermVector returns the occurrences of term in field of the document
+// with the given internal id
+func docTermVector(reader index.IndexReader, internalID index.IndexInternalID, field, term string) (termVector, error) {
+	tfr, err := reader.TermFieldReader([]byte(term), field, true, false, true)
+	if err != nil {
+		return termVector{}, err
+	}
+	defer tfr.Close()
+	tfd, err := tfr.Advance(internalID, nil)
+	if err != nil {
+		return termVector{}, err
+	}
+	rv := termVector{
+		Positions: []termPosition{},
+	}
+	if tfd == nil || !tfd.ID.Equals(internalID) {
+		return rv, nil
+	}
+	rv.Freq = tfd.Freq
+	for _, v := range tfd.Vectors {
+		if v.Field != field {
+			continue
+		}
+		rv.Positions = append(rv.Positions, termPosition{
+			Pos:            v.Pos,
+			Start:          v.Start,
+			End:            v.End,
+			ArrayPositions: v.ArrayPositions,
+		})
+	}
+	return rv, nil
+}
@@ -0,0 +1,87 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+func TestTermVectors(t *testing.T) {
+	index := newTestIndex(t, map[string]interface{}{
+		"stout": map[string]interface{}{
+			"type":        "beer",
+			"name":        "Dark Night",
+			"description": "dark stout, creamy stout",
+			"style":       "Oatmeal Stout",
+		},
+	})
+	defer index.Close()
+	bleveHttp.RegisterIndexName("termVectorsTest", index)
+	defer bleveHttp.UnregisterIndexByName("termVectorsTest")
+
+	serve := func(docID string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/termvectors/"+docID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := newTermVectorsHandler("termVectorsTest")
+		handler.DocIDLookup = func(*http.Request) string { return docID }
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("stout")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result struct {
+		ID     string                           `json:"id"`
+		Fields map[string]map[string]termVector `json:"fields"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	description := result.Fields["description"]
+	expected := termVector{
+		Freq: 2,
+		Positions: []termPosition{
+			{Pos: 2, Start: 5, End: 10},
+			{Pos: 4, Start: 19, End: 24},
+		},
+	}
+	if !reflect.DeepEqual(description["stout"], expected) {
+		t.Errorf("expected description stout %+v, got %+v", expected, description["stout"])
+	}
+	if description["dark"].Freq != 1 {
+		t.Errorf("expected description dark freq 1, got %+v", description["dark"])
+	}
+	if _, ok := description["night"]; ok {
+		t.Errorf("expected no night in description, got %+v", description)
+	}
+
+	// fields without term vectors still report frequencies
+	style := result.Fields["style"]["Oatmeal Stout"]
+	if style.Freq != 1 || len(style.Positions) != 0 {
+		t.Errorf("expected style term with freq 1 and no positions, got %+v", style)
+	}
+
+	if rr := serve("missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for missing document, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,113 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/collector"
+)
+
+// timedSearch runs searchRequest, giving up once ctx is done. With partial
+// set, a search that times out returns the hits collected so far instead of
+// an error, and reports that it timed out.
+func timedSearch(ctx context.Context, index bleve.Index, searchRequest *bleve.SearchRequest,
+	partial bool) (*bleve.SearchResult, bool, error) {
+	var p *partialHits
+	if partial {
+		p = &partialHits{
+			size: searchRequest.From + searchRequest.Size,
+		}
+		ctx = p.context(ctx)
+	}
+	searchResult, err := index.SearchInContext(ctx, searchRequest)
+	if err == context.DeadlineExceeded && partial {
+		return p.result(searchRequest), true, nil
+	}
+	return searchResult, false, err
+}
+
+// partialHits records the hits seen by a search as it runs, so the best of
+// them can be returned if the search times out. Partial results are ordered
+// by score, and carry no stored fields or highlighting.
+type partialHits struct {
+	size  int
+	hits  search.DocumentMatchCollection
+	total uint64
+	start time.Time
+}
+
+// context returns ctx set up so a search using it records its hits in p, as
+// well as collecting them as usual
+func (p *partialHits) context(ctx context.Context) context.Context {
+	p.start = time.Now()
+	return context.WithValue(ctx, search.MakeDocumentMatchHandlerKey,
+		search.MakeDocumentMatchHandler(func(sctx *search.SearchContext) (search.DocumentMatchHandler, bool, error) {
+			next, _, err := collector.MakeTopNDocumentMatchHandler(sctx)
+			if err != nil {
+				return nil, false, err
+			}
+			// hits are recycled once handled, so copy what is needed, and
+			// ask for their ids to be loaded
+			return func(d *search.DocumentMatch) error {
+				if d != nil {
+					p.add(d)
+				}
+				return next(d)
+			}, true, nil
+		}))
+}
+
+func (p *partialHits) add(d *search.DocumentMatch) {
+	p.total++
+	p.hits = append(p.hits, &search.DocumentMatch{
+		ID:    d.ID,
+		Score: d.Score,
+	})
+	if len(p.hits) > 2*p.size+16 {
+		p.trim()
+	}
+}
+
+// trim keeps the size best hits
+func (p *partialHits) trim() {
+	sort.Stable(p.hits)
+	if len(p.hits) > p.size {
+		p.hits = p.hits[:p.size]
+	}
+}
+
+// result returns the requested page of the hits recorded so far
+func (p *partialHits) result(searchRequest *bleve.SearchRequest) *bleve.SearchResult {
+	p.trim()
+	rv := &bleve.SearchResult{
+		Status: &bleve.SearchStatus{
+			Total:      1,
+			Successful: 1,
+		},
+		Request: searchRequest,
+		Hits:    search.DocumentMatchCollection{},
+		Total:   p.total,
+		Took:    time.Since(p.start),
+	}
+	for _, hit := range p.hits {
+		if hit.Score > rv.MaxScore {
+			rv.MaxScore = hit.Score
+		}
+	}
+	if searchRequest.From < len(p.hits) {
+		rv.Hits = p.hits[searchRequest.From:]
+	}
+	return rv
+}
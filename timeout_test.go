@@ -0,0 +1,130 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	bleveHttp "github.com/blevesearch/bleve/http"
+)
+
+var closedChan = make(chan struct{})
+
+func init() {
+	close(closedChan)
+}
+
+// doneAfterContext is done once Done has been called more than calls
+// times. Bleve checks for cancellation every 1024 hits, so this times a
+// search out part way through regardless of how fast it runs.
+type doneAfterContext struct {
+	context.Context
+	calls int
+}
+
+func (c *doneAfterContext) Done() <-chan struct{} {
+	c.calls--
+	if c.calls < 0 {
+		return closedChan
+	}
+	return nil
+}
+
+func (c *doneAfterContext) Err() error {
+	if c.calls < 0 {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestSearchPartialOnTimeout(t *testing.T) {
+	docs := make(map[string]interface{})
+	for i := 0; i < 3000; i++ {
+		docs[fmt.Sprintf("ale-%d", i)] = map[string]interface{}{
+			"type": "beer",
+			"name": fmt.Sprintf("Ale %d", i),
+		}
+	}
+	index := newTestIndex(t, docs)
+	defer index.Close()
+	bleveHttp.RegisterIndexName("timeoutTest", index)
+	defer bleveHttp.UnregisterIndexByName("timeoutTest")
+
+	serve := func(rawQuery string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/search?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := newSearchQueryHandler("timeoutTest")
+		handler.withTimeout = func(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+			return &doneAfterContext{Context: ctx, calls: 2}, func() {}
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	var result struct {
+		Hits []struct {
+			ID string `json:"id"`
+		} `json:"hits"`
+		Total    uint64 `json:"total_hits"`
+		TimedOut bool   `json:"timed_out"`
+	}
+
+	// by default a timed out search fails
+	if rr := serve("q=ale&timeout=1s"); rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := serve("q=ale&timeout=1s&partialOnTimeout=1&size=5")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut {
+		t.Errorf("expected timed_out to be set")
+	}
+	if result.Total == 0 || result.Total >= 3000 {
+		t.Errorf("expected a partial total, got %d", result.Total)
+	}
+	if len(result.Hits) != 5 || result.Hits[0].ID == "" {
+		t.Errorf("expected 5 partial hits, got %v", result.Hits)
+	}
+
+	// options that partial hits cannot honour are rejected
+	for _, param := range []string{"sort=abv", "rescore=score*2", "decay=exp&decayScale=24h", "dedupByName=1", "highlight=1"} {
+		if rr := serve("q=ale&timeout=1s&partialOnTimeout=1&" + param); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 with %s, got %d", param, rr.Code)
+		}
+	}
+	if rr := serve("q=ale&timeout=1s&partialOnTimeout=1&highlight=0"); rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 without highlight, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// searches completing in time are unaffected
+	rr = serve("q=ale&partialOnTimeout=1&size=5")
+	result.TimedOut = true
+	err = json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TimedOut || result.Total != 3000 {
+		t.Errorf("expected a complete search, got total %d timed out %t", result.Total, result.TimedOut)
+	}
+}